@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/betrok/ttyhstore/store"
+)
+
+// Exit codes.
+const (
+	exitOK = 0
+	// command failed
+	exitFatal = 1
+	// command finished, but some clients are invalid or problems were found
+	exitInvalid = 2
+	// store is locked by another process
+	exitLocked = 3
+)
+
+// eventActions print JSON lines with --output=json.
+var eventActions = map[string]bool{
+	"check":   true,
+	"collect": true,
+	"cleanup": true,
+	"clone":   true,
+}
+
+// jsonEvents reports whether action prints events to stdout.
+func jsonEvents(action string) bool {
+	return output == "json" && eventActions[action]
+}
+
+// summary is the last line printed by eventWriter.
+type summary struct {
+	Type    string `json:"type"`
+	Action  string `json:"action"`
+	Checked int    `json:"checked"`
+	Reused  int    `json:"reused"`
+	// clients failed to check
+	Invalid        []string `json:"invalid,omitempty"`
+	Downloaded     int      `json:"downloaded"`
+	DownloadedSize int64    `json:"downloadedSize"`
+	Warnings       int      `json:"warnings"`
+	// files missing in offline mode
+	Missing  int `json:"missing"`
+	ExitCode int `json:"exitCode"`
+}
+
+// eventWriter prints store events to stdout as JSON lines and sums them up.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	sum summary
+}
+
+func newEventWriter(action string) *eventWriter {
+	return &eventWriter{
+		enc: json.NewEncoder(os.Stdout),
+		sum: summary{Type: "summary", Action: action},
+	}
+}
+
+func (ew *eventWriter) Emit(e store.Event) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	switch e.Type {
+	case store.EventChecked:
+		ew.sum.Checked++
+		if e.Reused {
+			ew.sum.Reused++
+		}
+		if e.Message != "" {
+			ew.sum.Invalid = append(ew.sum.Invalid, e.Client)
+		}
+
+	case store.EventDownloaded:
+		ew.sum.Downloaded++
+		ew.sum.DownloadedSize += e.Size
+
+	case store.EventWarning:
+		ew.sum.Warnings++
+	}
+	_ = ew.enc.Encode(e)
+}
+
+// Finish prints summary.
+func (ew *eventWriter) Finish(code, missing int) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	ew.sum.Missing = missing
+	ew.sum.ExitCode = code
+	_ = ew.enc.Encode(ew.sum)
+}
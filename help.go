@@ -0,0 +1,244 @@
+package main
+
+var helpMessage = `Usage: %s [options] [command] [args]
+
+Commands:
+	
+	check [<prefix1>/]<version1> [[<prefix2>/]<version2>] [...]
+		Check whatever specified clients are consistent,
+		if possible download missing files from official repos.
+		If prefix isn't provided will search in default.
+	
+	audit [[<prefix1>/]<version1>] [...]
+		Perform all checks for specified or all clients without writing
+		or downloading anything and compare results with published data.json.
+		Reports changed files, missing objects and libs that differ
+		from published ones. Exits with error if any drift is found.
+	
+	collect
+		Check all client versions,
+		geneate new versions.json in all prefixes.
+		Clients unchanged since the last collect are not rechecked.
+		
+	clone [--type=<type>] [--since=<version>] [--latest] [--all-snapshots-after=<date>] [<off_version1>] [...]
+		Clone clients from official repos to default prefix.
+		Besides passed ids versions are selected from the manifest:
+		of type and released since version (inclusive), the latest ones
+		(of type if set) and snapshots released after date (YYYY-MM-DD).
+		Selected clients, that already exist, are skipped.
+		Plan with estimated download size is shown first.
+	
+	daemon [--every=<duration>] [--type=<type>] [--since=<version>] [--latest] [--all-snapshots-after=<date>]
+		Periodically (every hour by default) sync default prefix with
+		official repos: clone versions selected by filter as in clone,
+		that are missing in prefix, and run collect if anything was cloned.
+		Manifest is requested conditionally, nothing is done until it is changed.
+		Store is locked while sync, status of the last run is kept
+		in .sync-status.json in the storage root.
+	
+	upstream-check [--update] [[<prefix1>/]<version1>] [...]
+		Compare upstream json of specified or all cloned clients
+		with the one they were cloned from and show changed fields
+		and libraries. With --update changed clients are re-cloned,
+		fields changed locally are kept. Exits with error if any
+		client is left outdated.
+	
+	diff [--output=json] [<prefix>/]<version1> [<prefix>/]<version2>
+		Show changes between two checked clients: jar, main class,
+		assets index, libraries, custom files and mutables.
+	
+	du [--output=json]
+		Show disk usage of published clients per prefix and version:
+		jar, custom files, libraries and assets with their indexes.
+		Libraries and assets are split into unique, freed if version
+		or prefix is deleted, and shared with other clients. Jar linked
+		by new --link is freed only with the last client using it.
+	
+	why <lib path|asset hash|file hash> [...]
+		List clients, that use library (path relative to libraries/),
+		asset or client jar and custom file with passed sha1.
+		Uses references.json generated by the last collect.
+	
+	fsck [--repair]
+		Verify whole store, including files not required by any client:
+		assets objects against their names, libraries against .sha1 files
+		or hashes in data.json of clients and assets indexes.
+		Reports corrupt, stray and missing files and libraries,
+		that can't be verified (left as is by repair).
+		With --repair corrupt and missing objects are fetched from official repos
+		or repos set for libraries by clients, anything else, including
+		leftovers of interrupted writes, is moved to .quarantine/ in the storage root.
+	
+	fetch --list=<fetch list> --out=<bundle.tar>
+		Download files from fetch list (see --fetch-list) to tar bundle,
+		laid out like the store. Store root isn't required.
+	
+	import-bundle <bundle1.tar> [<bundle2.tar>] [...]
+		Verify hashes of files from bundle created by fetch
+		and place them to the store.
+	
+	prefix create|set <prefix> [--about=<text>] [--type=<type>] [--latest=<type1>:<version1>[,...]]
+		Create prefix or change its prefix.json. Type is one of public, hidden
+		or private, default is public. Latest overrides are checked against
+		existing clients, empty version removes override. Unlike clone,
+		--latest takes value, it must follow "=". Client types are rejected
+		by --type here, as prefix types are by clone, daemon and new.
+		Published lists are regenerated.
+	
+	prefix show <prefix>
+		Print prefix.json, defaults if it is missing.
+	
+	prefix list [--output=json]
+		List prefixes with their clients and latest versions
+		without checking clients.
+	
+	token issue <prefix> [--about=<text>]
+		Issue access token for private prefix. Token is shown only once.
+	
+	token revoke <prefix> <token id>
+		Revoke token of prefix.
+	
+	token list <prefix>
+		List ids of prefix tokens.
+	
+	serve [--listen=<addr>] [--proxy [--proxy-maven]]
+		Serve store over HTTP, default address is ":8080".
+		With --proxy libraries and assets objects missing in the store
+		are fetched from official repos, verified by hash, stored and served.
+		Only objects referenced by clients of the store are fetched,
+		--proxy-maven allows any library with maven layout as well.
+		Upstream 404 is passed as is, while the store is locked
+		exclusively 503 is returned.
+		Files of private prefixes require token passed in
+		"Authorization: Bearer <token>" header or "token" query parameter.
+		Libraries and assets stay public, dot files and references.json
+		are never served.
+	
+	new --from=[<prefix>/]<base> [--type=<type>] [--files] [--link] [<prefix>/]<version>
+		Create custom client from existing one: jar is copied
+		or hard linked with --link, then it must be replaced, not overwritten.
+		<version>.json gets new id and fresh time and releaseTime.
+		Upstream downloads are dropped from it, so jar may be replaced.
+		With --type client type is changed, with --files files/
+		and mutables.list are copied as well. New client is checked,
+		run collect to publish it.
+	
+	rm [--cleanup] [<prefix1>/]<version1> [[<prefix2>/]<version2>] [...]
+		Delete clients and regenerate versions.json of their prefixes,
+		prefixes.json and references.json. With --cleanup libraries
+		and assets, that aren't required anymore, are deleted as well.
+	
+	mv [<prefix1>/]<version1> [<prefix2>/]<version2>
+	cp [<prefix1>/]<version1> [<prefix2>/]<version2>
+		Move or copy client to other prefix or version id.
+		Id in <version>.json is rewritten, lists are regenerated like in rm.
+		The copy is published only if the source client is.
+	
+	migrate
+		Rewrite generated prefixes.json, versions.json and data.json files
+		to format set by --format without checking clients.
+		
+	help
+		Show this message.
+		
+	cleanup
+		Alias to "--cleanup collect"
+		
+Options:
+	
+	-v
+		Be more verbose: log downloads, already checked or existing files
+		and generated versions.json and prefixes.json (debug level).
+	
+	-q
+		Be quiet: log only warnings and errors. Results of commands
+		like du, diff or audit are printed anyway.
+	
+	--log-level=<error|warn|info|debug>
+		Log messages up to level, info by default. Same as -v
+		for debug and -q for warn, can't be used with them.
+	
+	--timestamps
+		Prefix log lines with date and time.
+	
+	--log-file=<path>
+		Append log to file instead of stdout. File is rotated
+		when it grows over --log-max-size, 5 old files are kept
+		as <path>.1 ... <path>.5.
+	
+	--log-max-size=<MB>
+		Maximum size of log file in megabytes, default is 10.
+		
+	--root=<path>
+		Overwrite storage root, default may be set by $TTYH_STORE env variable.
+		Use s3://<bucket>[/<key prefix>] to keep store in S3-compatible storage,
+		credentials are taken from $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY
+		and $AWS_REGION.
+	
+	--s3-endpoint=<url>
+		S3 service endpoint, default may be set by $S3_ENDPOINT env variable.
+		Amazon S3 is used if not defined.
+		
+	--ignore=<prefix1>/<version1>[,<prefix2>/<version2>][...]
+		Don't check specified versions while collect.
+		
+	--prefix=<prefix>
+		Set default prefix for clone or check. Predefined is "default".
+		
+	--last=<prefix1>/<type1>:<version1>[,<prefix2>/<type2>:<version2>][...]
+		Overwrite latest versions in versions.json manually.
+		Default choice based on releaseTime in <version>.json.
+		
+	--output=<text|json>
+		Output format of du, diff and prefix list. Default is human-readable text.
+		With json check, collect, cleanup and clone print events (checked,
+		downloaded, warning, error) as JSON lines and summary as the last line
+		to stdout, text log goes to stderr (or --log-file).
+	
+	--cleanup
+		After collect delete all libraries and assets,
+		that aren't required by any client.
+		Cleanup will be abort if any of clients is inconsistent.
+	
+	--replace
+		Replace existing libraries if they do not match expectations.
+	
+	--full
+		Check all clients while collect, even unchanged ones.
+	
+	--offline
+		Don't download anything. Missing libraries, assets and client files
+		are listed with expected sha1 and size at the end.
+	
+	--fetch-list=<file>
+		Save files missing in offline mode to <file> as JSON fetch list.
+	
+	--jobs=<n>
+		Number of clients checked concurrently while collect.
+		Default is number of CPUs.
+	
+	--format=<n>
+		Format version of generated files, default is the latest one.
+		Use 1 for launchers, that don't know about formatVersion field.
+	
+	--hash=<alg1>[,<alg2>][...]
+		Compute additional hashes for data.json, sha1 is always present.
+		Supported: sha256. Hashes present in <version>.json are verified anyway.
+	
+	--wait
+		Wait until store lock is released instead of failing.
+		Commands, that modify the store, lock it exclusively,
+		read-only ones (audit, why, du, diff, fsck without --repair,
+		upstream-check without --update, prefix show and list, token list)
+		share the lock. Serve shares it only while proxy fetches a file,
+		daemon locks it for every sync. Only local stores are locked.
+
+Exit codes:
+	
+	0	Success.
+	1	Fatal error.
+	2	Command finished, but some clients are invalid or problems were found:
+		check, collect or cleanup found invalid clients, audit found drift,
+		fsck left problems, upstream-check left outdated clients.
+	3	Store is locked by another process, see --wait.
+`
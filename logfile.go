@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// logBackups is number of rotated log files kept besides the current one.
+const logBackups = 5
+
+// rotatingFile is log output, that is rotated when it grows over max size:
+// <name> is renamed to <name>.1, older files are shifted up to <name>.<backups>.
+// Other processes sharing the file keep writing to the rotated one until they rotate it
+// themselves, so order of lines may break, but nothing is lost.
+type rotatingFile struct {
+	mu      sync.Mutex
+	name    string
+	max     int64
+	backups int
+	fd      *os.File
+	size    int64
+}
+
+func openLogFile(name string, max int64, backups int) (*rotatingFile, error) {
+	lf := &rotatingFile{name: name, max: max, backups: backups}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *rotatingFile) open() error {
+	fd, err := os.OpenFile(lf.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	lf.fd, lf.size = fd, fi.Size()
+	return nil
+}
+
+func (lf *rotatingFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.size != 0 && lf.size+int64(len(p)) > lf.max {
+		if err := lf.rotate(); err != nil {
+			return 0, fmt.Errorf("log rotation failed: %v", err)
+		}
+	}
+	n, err := lf.fd.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+func (lf *rotatingFile) rotate() error {
+	if err := lf.fd.Close(); err != nil {
+		return err
+	}
+	for i := lf.backups; i > 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", lf.name, i-1), fmt.Sprintf("%s.%d", lf.name, i))
+		if err != nil && !os.IsNotExist(err) {
+			_ = lf.open()
+			return err
+		}
+	}
+	var err error
+	if lf.backups > 0 {
+		err = os.Rename(lf.name, lf.name+".1")
+	} else {
+		err = os.Remove(lf.name)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		// keep writing to the current file
+		_ = lf.open()
+		return err
+	}
+	return lf.open()
+}
@@ -1,10 +1,6 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,51 +10,108 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
+
+	"github.com/betrok/ttyhstore/store"
 )
 
 var (
-	storeRoot   string
-	specialDirs = []string{"libraries", "assets"}
+	prefix string
 
-	url = struct {
-		Versions, Manifest, Libraries, Indexes, Assets string
-	}{
-		Manifest:  "https://launchermeta.mojang.com/mc/game/version_manifest.json",
-		Libraries: "https://libraries.minecraft.net/",
-		Indexes:   "https://s3.amazonaws.com/Minecraft.Download/indexes/",
-		Assets:    "https://resources.download.minecraft.net/",
-	}
+	cleanup bool
 
-	osList   = []string{"linux", "windows", "osx" /*, "MS-DOS"*/}
-	archList = []string{ /*"3.14", "8", "16",*/ "32", "64" /*, "128"*/}
+	fetchList string
 
-	customLast   = map[string]string{}
-	ignoreList   = map[string]bool{}
-	libOverwrite []*regexp.Regexp
+	listFile, outFile string
 
-	prefix string
+	repair, update bool
+
+	output string
+
+	from, clientType string
+	withFiles, link  bool
+
+	about, latest string
+
+	since, snapshotsAfter string
 
-	verbose, cleanup, replace bool
+	every time.Duration
 
-	checked = struct {
-		libs            map[string]FInfo
-		indexes, assets map[string]bool
-	}{map[string]FInfo{}, map[string]bool{}, map[string]bool{}}
+	wait bool
 
-	invalids bool
+	listen            string
+	proxy, proxyMaven bool
+
+	// diagnostics, results of commands are printed to stdout
+	logger = store.NewLogger(os.Stdout, 0, store.LevelInfo)
 )
 
-const overwriteFile = "overwrite.list"
+// fatal logs error and exits before the store is opened.
+func fatal(format string, v ...interface{}) {
+	logger.Errorf(format, v...)
+	os.Exit(exitFatal)
+}
 
 func main() {
-	log.SetFlags(0)
-	log.SetOutput(os.Stdout)
+	action, args, opts := configure()
+	switch action {
+	case "help":
+		flag.Usage()
+		return
+
+	case "fetch":
+		// doesn't need a store, runs on connected machine
+		if err := fetch(opts.Log); err != nil {
+			fatal("Fetch failed: %v", err)
+		}
+		return
+	}
+
+	// stdout is left for JSON lines, log is moved to stderr by configure
+	var events *eventWriter
+	if jsonEvents(action) {
+		events = newEventWriter(action)
+		opts.Events = events.Emit
+	}
 
-	action, args := configure()
+	s, err := store.New(opts)
+	if err != nil {
+		fatal("%v", err)
+	}
+
+	unlock := func() {}
+	// missing files should be listed even if run failed
+	exit := func(code int) {
+		missing := reportMissing(s)
+		if events != nil {
+			events.Finish(code, missing)
+		}
+		unlock()
+		os.Exit(code)
+	}
+	fatalf := func(code int, format string, v ...interface{}) {
+		msg := fmt.Sprintf(format, v...)
+		if events != nil {
+			events.Emit(store.Event{Type: store.EventError, Time: time.Now().UTC(), Message: msg})
+		}
+		logger.Errorf("%s", msg)
+		exit(code)
+	}
+
+	if lock, exclusive := lockMode(action, args); lock {
+		unlock, err = s.Lock(exclusive, wait)
+		if _, ok := err.(*store.LockedError); ok {
+			unlock = func() {}
+			fatalf(exitLocked, "%v, use --wait to wait until it is released", err)
+		} else if err != nil {
+			unlock = func() {}
+			fatalf(exitFatal, "Failed to lock store: %v", err)
+		}
+	}
 
 	switch action {
 	case "cleanup":
@@ -66,1036 +119,900 @@ func main() {
 		fallthrough
 
 	case "collect":
-		collectAll()
+		if err := s.Collect(); err != nil {
+			fatalf(exitCode(err), "%v", err)
+		}
 		if cleanup {
-			if invalids {
-				log.Println("Cleanup aborted in case of invalid cli")
-			} else {
-				clean()
+			if err := s.Cleanup(); err != nil {
+				fatalf(exitCode(err), "%v", err)
 			}
 		}
 
 	case "check":
+		invalid := 0
 		for _, cli := range args {
-			var err error
-			switch strings.Count(cli, "/") {
-			case 0:
-				_, err = checkCli(storeRoot+prefix+"/"+cli+"/", false)
-
-			case 1:
-				_, err = checkCli(storeRoot+cli+"/", false)
-
-			default:
-				log.Fatalf("Too many slashes in \"%s\"", cli)
-			}
+			_, err := s.Check(splitClient(cli))
 			if err != nil {
-				log.Printf("Client \"%s\" check failed: %v\n", cli, err)
+				invalid++
+				logger.Errorf("Client \"%s\" check failed: %v", cli, err)
 			}
-			log.Println()
+			logger.Println()
+		}
+		if invalid != 0 {
+			fatalf(exitInvalid, "%d clients are invalid", invalid)
 		}
 
-	case "clone":
-		log.Printf("Clone to prefix \"%s\"", prefix)
-		for _, cli := range args {
-			if err := cloneCli(storeRoot+prefix+"/", cli); err != nil {
-				log.Fatalf("Clone version \"%s\" failed: %v", cli, err)
+	case "audit":
+		var drifts []*store.Drift
+		if len(args) == 0 {
+			if drifts, err = s.AuditAll(); err != nil {
+				fatalf(exitFatal, "%v", err)
 			}
 		}
+		for _, cli := range args {
+			drifts = append(drifts, s.Audit(splitClient(cli)))
+			logger.Println()
+		}
+		if n := reportDrifts(drifts); n != 0 {
+			fatalf(exitInvalid, "Drift found in %d clients", n)
+		}
 
-	default:
-		flag.Usage()
-	}
-}
-
-func configure() (action string, args []string) {
-	storeRoot = os.Getenv("TTYH_STORE")
-
-	var last, ignore string
-	var help bool
-
-	flag.BoolVar(&help, "help", false, "generated help sucks, overwrite it")
-	flag.BoolVar(&verbose, "v", false, "")
-	flag.BoolVar(&cleanup, "cleanup", false, "")
-	flag.BoolVar(&replace, "replace", false, "")
-	flag.StringVar(&storeRoot, "root", storeRoot, "")
-	flag.StringVar(&last, "last", "", "")
-	flag.StringVar(&ignore, "ignore", "", "")
-	flag.StringVar(&prefix, "prefix", "default", "")
-
-	flag.Usage = func() { log.Printf(helpMessage, os.Args[0]) }
-	flag.Parse()
-
-	if len(storeRoot) == 0 {
-		log.Println("Srote root not defined.")
-		help = true
-	}
-
-	if help {
-		return "help", flag.Args()
-	}
-
-	if inSlice(prefix, specialDirs) || len(prefix) == 0 {
-		log.Fatal("Passed prefix belongs to special directories")
-	}
-
-	if storeRoot[len(storeRoot)-1] != '/' {
-		storeRoot += "/"
-	}
+	case "migrate":
+		logger.Infof("Migrating generated files to format %d", opts.Format)
+		if err := s.Migrate(); err != nil {
+			fatalf(exitFatal, "Migration failed: %v", err)
+		}
+		logger.Println("Migration finished")
 
-	if len(last) != 0 {
-		for _, t := range strings.Split(last, ",") {
-			part := strings.Split(last, ":")
-			if len(part) != 2 {
-				log.Printf("Invalid --last format in \"%s\"", t)
-				return "help", nil
+	case "why":
+		for _, object := range args {
+			refs, err := s.Why(object)
+			if err != nil {
+				fatalf(exitFatal, "%v", err)
+			}
+			if len(refs) == 0 {
+				fmt.Printf("\"%s\" isn't used by any client\n", object)
+				continue
+			}
+			fmt.Printf("\"%s\" is used by:\n", object)
+			for _, ref := range refs {
+				fmt.Printf("\t%s\t(%s)\n", ref.Client, ref.Via)
 			}
-			customLast[part[0]] = part[1]
 		}
-	}
 
-	if len(ignore) != 0 {
-		for _, item := range strings.Split(ignore, ",") {
-			ignoreList[item] = true
+	case "rm":
+		for _, cli := range args {
+			if err := s.Remove(splitClient(cli)); err != nil {
+				fatalf(exitFatal, "Remove \"%s\" failed: %v", cli, err)
+			}
+		}
+		if cleanup {
+			if err := s.Cleanup(); err != nil {
+				fatalf(exitFatal, "%v", err)
+			}
 		}
-	}
-
-	err := readLibOverwrite()
-	if err != nil {
-		log.Fatalf("failed to prerare lib owerwrite: %v", err)
-	}
-
-	args = flag.Args()
-	if len(args) == 0 {
-		return "collect", args
-	}
-	return args[0], args[1:]
-}
 
-func readLibOverwrite() error {
-	fd, err := os.Open(storeRoot + "libraries/" + overwriteFile)
-	switch {
-	case err == nil:
+	case "mv", "cp":
+		if len(args) != 2 {
+			fatalf(exitFatal, "%s requires source and destination clients", action)
+		}
+		fromPrefix, fromVersion := splitClient(args[0])
+		toPrefix, toVersion := splitClient(args[1])
+		if err := s.Copy(fromPrefix, fromVersion, toPrefix, toVersion, action == "mv"); err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
 
-	case os.IsNotExist(err):
-		// whatever
-		return nil
+	case "serve":
+		handler := s.Handler()
+		if proxy {
+			handler = s.ProxyHandler(proxyMaven)
+		}
+		logger.Infof("Serving store on %s", listen)
+		fatalf(exitFatal, "%v", http.ListenAndServe(listen, handler))
 
-	default:
-		return err
-	}
+	case "token":
+		if err := tokenCommand(s, args); err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
 
-	defer fd.Close()
+	case "prefix":
+		if err := prefixCommand(s, args); err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
 
-	sc := bufio.NewScanner(fd)
-	for sc.Scan() {
-		if sc.Text() == "" {
-			continue
+	case "new":
+		if len(args) != 1 || len(from) == 0 {
+			fatalf(exitFatal, "new requires client id and --from")
 		}
-		r, err := regexp.Compile(sc.Text())
+		toPrefix, id := splitClient(args[0])
+		fromPrefix, fromVersion := splitClient(from)
+		_, err := s.Scaffold(toPrefix, id, store.ScaffoldOptions{
+			FromPrefix: fromPrefix,
+			From:       fromVersion,
+			Type:       clientType,
+			Files:      withFiles,
+			Link:       link,
+		})
 		if err != nil {
-			return fmt.Errorf("%v : %v", sc.Text(), err)
+			fatalf(exitFatal, "Client \"%s\" creation failed: %v", args[0], err)
 		}
-		libOverwrite = append(libOverwrite, r)
-	}
-	return sc.Err()
-}
 
-func cloneCli(prefixRoot, cli string) error {
-	manifestPath := storeRoot + "version_manifest.json"
-	err := getFile(&Download{URL: url.Manifest}, manifestPath)
-	if err != nil {
-		return err
-	}
+	case "diff":
+		if len(args) != 2 {
+			fatalf(exitFatal, "diff requires exactly two clients")
+		}
+		fromPrefix, fromVersion := splitClient(args[0])
+		toPrefix, toVersion := splitClient(args[1])
+		d, err := s.Diff(fromPrefix, fromVersion, toPrefix, toVersion)
+		if err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
+		if output == "json" {
+			data, _ := json.MarshalIndent(d, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			printDiff(d)
+		}
 
-	fd, err := os.Open(manifestPath)
-	if err != nil {
-		return err
-	}
-	defer fd.Close()
+	case "du":
+		usage, err := s.DiskUsage()
+		if err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
+		if output == "json" {
+			data, _ := json.MarshalIndent(usage, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			printUsage(usage)
+		}
 
-	var manifest VersionManifest
-	err = json.NewDecoder(fd).Decode(&manifest)
-	if err != nil {
-		return fmt.Errorf("failed to decode version manifest: %v", err)
-	}
+	case "fsck":
+		report, err := s.Fsck(repair)
+		if err != nil {
+			fatalf(exitFatal, "Fsck failed: %v", err)
+		}
+		if n := reportFsck(report); n != 0 {
+			fatalf(exitInvalid, "%d problems left", n)
+		}
 
-	var version VInfoMin
-	for _, t := range manifest.Versions {
-		if t.Id == cli {
-			version = t
-			break
+	case "import-bundle":
+		for _, name := range args {
+			if err := importBundle(s, name); err != nil {
+				fatalf(exitFatal, "Import of \"%s\" failed: %v", name, err)
+			}
 		}
-	}
-	if version.Id == "" {
-		return fmt.Errorf("requseted version not found in manifest")
-	}
 
-	err = getFile(&Download{URL: version.URL}, prefixRoot+cli+"/"+cli+".json")
-	if err != nil {
-		return err
-	}
+	case "upstream-check":
+		var changes []*store.UpstreamChange
+		if len(args) == 0 {
+			if changes, err = s.UpstreamCheckAll(update); err != nil {
+				fatalf(exitFatal, "%v", err)
+			}
+		}
+		for _, cli := range args {
+			p, v := splitClient(cli)
+			changes = append(changes, s.UpstreamCheck(p, v, update))
+		}
+		if n := reportUpstream(changes); n != 0 {
+			fatalf(exitInvalid, "%d clients changed upstream", n)
+		}
 
-	_, err = checkCli(prefixRoot+cli+"/", true)
-	return err
-}
+	case "daemon":
+		filter, err := cloneFilter()
+		if err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
+		if filter.Empty() {
+			fatalf(exitFatal, "daemon requires versions filter, see clone")
+		}
+		if every <= 0 {
+			fatalf(exitFatal, "--every must be positive")
+		}
+		for {
+			// store keeps checked objects, latest versions and failures of its run,
+			// so files removed by cleanup or prefix.json changed meanwhile are seen
+			ds, err := store.New(opts)
+			if err != nil {
+				fatalf(exitFatal, "%v", err)
+			}
+			status := ds.Sync(prefix, filter)
+			if status.Err != "" {
+				logger.Warnf("Sync failed: %s", status.Err)
+			} else if len(status.Cloned) != 0 {
+				logger.Infof("Sync done, cloned: %s", strings.Join(status.Cloned, ", "))
+			}
+			logger.Infof("Next sync at %s", time.Now().Add(every).Format(time.RFC3339))
+			time.Sleep(every)
+		}
 
-func collectAll() {
-	dir, err := ioutil.ReadDir(storeRoot)
-	if err != nil {
-		log.Fatal("Can't read storeRoot directory", err)
-	}
-	plist := NewPrefixList()
-	for _, fi := range dir {
-		if !fi.IsDir() || inSlice(fi.Name(), specialDirs) || strings.HasPrefix(fi.Name(), ".") {
-			continue
+	case "clone":
+		filter, err := cloneFilter()
+		if err != nil {
+			fatalf(exitFatal, "%v", err)
+		}
+		plan, err := s.PlanClone(prefix, args, filter)
+		if err != nil {
+			fatalf(exitFatal, "%v", err)
 		}
+		printPlan(plan)
 
-		pinfo := collectPrefix(storeRoot + fi.Name() + "/")
-		if pinfo.Type != "hidden" {
-			plist.Prefixes[fi.Name()] = pinfo
+		for _, v := range plan.Versions {
+			if v.Exists {
+				continue
+			}
+			if err := s.ClonePlanned(plan, v); err != nil {
+				fatalf(exitFatal, "Clone version \"%s\" failed: %v", v.Id, err)
+			}
 		}
+
+	default:
+		flag.Usage()
 	}
 
-	data, _ := json.MarshalIndent(plist, "", "  ")
-	log.Println("Generated prefixes.json:")
-	log.Println(string(data))
+	exit(exitOK)
+}
 
-	fd, err := os.Create(storeRoot + "prefixes.json")
-	if err != nil {
-		log.Fatalf("Failed to create prefixes.json: %v", err)
-	}
-	_, err = fd.Write(data)
-	if err != nil {
-		log.Fatalf("Failed to write prefixes.json: %v", err)
-	}
-	err = fd.Close()
-	if err != nil {
-		log.Fatalf("Failed to write prefixes.json: %v", err)
+// exitCode returns exitInvalid for client check failures, exitFatal otherwise.
+func exitCode(err error) int {
+	if _, ok := err.(*store.ClientError); ok {
+		return exitInvalid
 	}
+	return exitFatal
 }
 
-func collectPrefix(prefixRoot string) PrefixInfo {
-	var err error
-	name := filepath.Base(prefixRoot)
+// lockMode reports whether action requires store lock and whether it modifies the store.
+// Long running actions don't hold the lock: serve writes only proxied objects,
+// daemon takes it for each sync.
+func lockMode(action string, args []string) (lock, exclusive bool) {
+	switch action {
+	case "serve", "daemon":
+		return false, false
 
-	log.Printf("\nJoining prefix \"%s\"\n\n", name)
+	case "audit", "why", "du", "diff":
+		return true, false
 
-	if err := os.MkdirAll(prefixRoot+"versions", os.ModeDir|0755); err != nil {
-		log.Fatal(err)
-	}
+	case "fsck":
+		return true, repair
 
-	var pInfo PrefixInfoExt
-	var fd *os.File
-	if fd, err = os.Open(prefixRoot + "prefix.json"); err == nil {
-		decoder := json.NewDecoder(fd)
-		err = decoder.Decode(&pInfo)
-		_ = fd.Close()
+	case "upstream-check":
+		return true, update
 
-		for t, v := range pInfo.Latest {
-			fullType := name + "/" + t
-			if _, ok := customLast[fullType]; !ok {
-				customLast[fullType] = v
-			}
-		}
-	} else {
-		log.Println("W: prefix.json read failed, use generic info\n")
-		pInfo.Type = "public"
+	case "prefix", "token":
+		return true, len(args) == 0 || args[0] != "show" && args[0] != "list"
 	}
+	return true, true
+}
 
-	prefix := NewPrefix()
+// splitClient parses "[<prefix>/]<version>", default prefix is used if it is omitted.
+func splitClient(cli string) (string, string) {
+	switch strings.Count(cli, "/") {
+	case 0:
+		return prefix, cli
 
-	dir, err := ioutil.ReadDir(prefixRoot)
-	if err != nil {
-		log.Fatal("Can't read prefix root directory", err)
+	case 1:
+		part := strings.Split(cli, "/")
+		return part[0], part[1]
+
+	default:
+		fatal("Too many slashes in \"%s\"", cli)
+		return "", ""
 	}
+}
 
-	for _, fi := range dir {
-		if !fi.IsDir() || fi.Name() == "versions" ||
-			ignoreList[name+"/"+fi.Name()] {
+// reportDrifts prints audit results and returns number of drifted clients.
+func reportDrifts(drifts []*store.Drift) (n int) {
+	fmt.Println("Audit results:")
+	for _, d := range drifts {
+		if d.Empty() {
+			fmt.Printf("%s: OK\n", d.Client)
 			continue
 		}
-
-		vInfo, err := checkCli(prefixRoot+fi.Name()+"/", false)
-		if err == nil {
-			prefix.Versions = append(prefix.Versions, &vInfo.VInfoMin)
-			lt, ok := prefix.latestTime[vInfo.Type]
-			if !ok || lt.Before(vInfo.Release) {
-				prefix.Latest[vInfo.Type] = vInfo.Id
-				prefix.latestTime[vInfo.Type] = vInfo.Release
-			}
-		} else {
-			invalids = true
-			log.Fatalf("Client \"%s\" check failed: %v\n", fi.Name(), err)
-		}
-		log.Println()
-	}
-
-	sort.Sort(VersionSlice(prefix.Versions))
-
-	for t := range prefix.Latest {
-		custom, ok := customLast[name+"/"+t]
-		if ok {
-			valid := false
-			for _, version := range prefix.Versions {
-				if version.Id == custom {
-					if version.Type != t {
-						log.Fatalf("In custom latest: mismatched client types for \"%s\"",
-							name+"/"+t)
-					}
-					valid = true
-					break
-				}
-			}
-			if !valid {
-				log.Fatalf("Custom latest for \"%s\" isn't consistent cli", name+"/"+t)
-			}
-
-			prefix.Latest[t] = custom
+		n++
+		fmt.Printf("%s:\n", d.Client)
+		if d.Err != nil {
+			fmt.Printf("\tcheck failed: %v\n", d.Err)
+		}
+		for _, path := range d.Missing {
+			fmt.Printf("\tmissing %s\n", path)
+		}
+		for _, change := range d.Changed {
+			fmt.Printf("\t%s\n", change)
 		}
 	}
+	return n
+}
 
-	data, _ := json.MarshalIndent(prefix, "", "  ")
-	log.Println("Generated version.json:")
-	log.Println(string(data))
-
-	fd, err = os.Create(prefixRoot + "versions/versions.json")
-	if err != nil {
-		log.Fatal("Create versions.json failed:", err)
-	}
-	_, err = fd.Write(data)
-	if err != nil {
-		log.Fatal("Create versions.json failed:", err)
-	}
-	err = fd.Close()
-	if err != nil {
-		log.Fatal("Create versions.json failed:", err)
+func tokenCommand(s *store.Store, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("token command and prefix required")
 	}
-	log.Printf("\nDone in prefix \"%s\"\n\n", name)
+	cmd, name := args[0], args[1]
 
-	return pInfo.PrefixInfo
-}
-
-func checkCli(versionRoot string, downloadJar bool) (*VInfoFull, error) {
-	version := filepath.Base(versionRoot)
+	switch cmd {
+	case "issue":
+		token, info, err := s.IssueToken(name, about)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token %s issued for prefix \"%s\":\n", info.ID, name)
+		fmt.Println(token)
 
-	log.Printf("Checking cli \"%s\"...\n", version)
+	case "revoke":
+		if len(args) != 3 {
+			return fmt.Errorf("token id required")
+		}
+		if err := s.RevokeToken(name, args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("Token %s revoked\n", args[2])
 
-	var (
-		fd   *os.File
-		err  error
-		info VInfoFull
-	)
-	if fd, err = os.Open(versionRoot + version + ".json"); err == nil {
-		err = json.NewDecoder(fd).Decode(&info)
+	case "list":
+		tokens, err := s.Tokens(name)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse %v.json: %v", version+".json")
+			return err
+		}
+		for _, t := range tokens {
+			fmt.Printf("%s\t%s\t%s\n", t.ID, t.Created.Format(time.RFC3339), t.About)
 		}
-		_ = fd.Close()
-	}
-	if err != nil {
-		return nil, err
-	}
 
-	if info.Id != version {
-		return nil, fmt.Errorf("mismatched dir name & client id: \"%s\" != \"%s\"\n", version, info.Id)
+	default:
+		return fmt.Errorf("unknown token command \"%s\"", cmd)
 	}
+	return nil
+}
 
-	log.Printf("%v.json: OK", version)
-
-	var files FilesInfo
-
-	jarPath := versionRoot + version + ".jar"
-	jarInfo := &info.Downloads.Client
+func prefixCommand(s *store.Store, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("prefix command required")
+	}
+	cmd, args := args[0], args[1:]
 
-	if downloadJar {
-		err = getFile(jarInfo, jarPath)
+	if cmd == "list" {
+		list, err := s.ListPrefixes()
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if output == "json" {
+			data, _ := json.MarshalIndent(list, "", "  ")
+			fmt.Println(string(data))
+			return nil
 		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "PREFIX\tTYPE\tCLIENTS\tLATEST\tABOUT")
+		for _, p := range list {
+			var last []string
+			for t, v := range p.Clients.Latest {
+				last = append(last, t+":"+v)
+			}
+			sort.Strings(last)
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", p.Name, p.Type, len(p.Clients.Versions),
+				strings.Join(last, ","), p.About)
+		}
+		return tw.Flush()
 	}
 
-	files.Main, err = getFInfo(jarPath)
-	if err != nil {
-		return nil, err
+	if len(args) != 1 {
+		return fmt.Errorf("prefix %s requires prefix name", cmd)
 	}
+	name := args[0]
 
-	if !jarInfo.Match(files.Main) {
-		return nil, fmt.Errorf("%s does not match expectations", version+".jar")
+	pInfo, err := s.PrefixInfo(name)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("%v.jar: OK", version)
-
-	if len(info.Assets) != 0 {
-		err = checkAssets(info.Assets, &info.AssetIndex)
-		if err != nil {
-			return nil, err
-		}
-		log.Println("Assets: OK")
-	} else {
-		log.Printf("W: No assets defined for \"%s\"\n", version)
-	}
+	switch cmd {
+	case "show":
+		data, _ := json.MarshalIndent(pInfo, "", "  ")
+		fmt.Println(string(data))
+		return nil
 
-	files.Files, err = collectCustoms(versionRoot)
-	switch {
-	case err == nil:
-		log.Println("Files: OK")
+	case "create":
+		pInfo = &store.PrefixInfoExt{PrefixInfo: store.PrefixInfo{Type: "public"}}
 
-	case os.IsNotExist(err):
-		log.Println("Files aren't present")
+	case "set":
 
 	default:
-		return nil, err
+		return fmt.Errorf("unknown prefix command \"%s\"", cmd)
 	}
 
-	files.Libs, err = checkLibs(info.Libs)
-	if err != nil {
-		return nil, err
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["about"] {
+		pInfo.About = about
 	}
-
-	log.Println("Libraries: OK")
-
-	data, _ := json.MarshalIndent(files, "", "  ")
-	fd, err = os.Create(versionRoot + "data.json")
-	if err != nil {
-		log.Fatalf("failed to create data.json: %v", err)
+	if set["type"] {
+		pInfo.Type = clientType
 	}
-	_, err = fd.Write(data)
-	if err != nil {
-		log.Fatalf("failed to write to data.json: %v", err)
-	}
-	_ = fd.Close()
+	if set["latest"] {
+		if pInfo.Latest == nil {
+			pInfo.Latest = make(map[string]string)
+		}
+		for _, t := range strings.Split(latest, ",") {
+			part := strings.Split(t, ":")
+			switch {
+			case len(part) != 2:
+				return fmt.Errorf("invalid --latest format in \"%s\"", t)
 
-	log.Printf("Cli \"%s\" seems to be suitable", version)
-	return &info, nil
-}
+			case part[1] == "":
+				delete(pInfo.Latest, part[0])
 
-func checkLibs(libInfo []LibInfo) (FIndex, error) {
-	log.Println("Checking libs...")
-	index := make(FIndex)
-
-	for _, lib := range libInfo {
-		if lib.Downloads != nil {
-			if lib.Downloads.Artifact != (LibDownload{}) {
-				err := checkLib(&lib.Downloads.Artifact, index)
-				if err != nil {
-					return nil, err
-				}
-			}
-			for _, class := range lib.Downloads.Classifiers {
-				err := checkLib(&class, index)
-				if err != nil {
-					return nil, err
-				}
-			}
-		} else {
-			err := checkLibOld(&lib, index)
-			if err != nil {
-				return nil, err
+			default:
+				pInfo.Latest[part[0]] = part[1]
 			}
 		}
 	}
-	return index, nil
+	return s.WritePrefixInfo(name, pInfo, cmd == "create")
 }
 
-func checkLibOverwrite(path string) bool {
-	for _, r := range libOverwrite {
-		if r.MatchString(path) {
-			return true
-		}
+func printDiff(d *store.ClientDiff) {
+	fmt.Printf("Changes from %s to %s:\n", d.From, d.To)
+	if d.Empty() {
+		fmt.Println("No changes")
+		return
 	}
-	return false
-}
-
-func checkLib(dl *LibDownload, index FIndex) error {
-	if info, ok := checked.libs[dl.Path]; ok {
-		if !dl.Match(info) {
-			if checkLibOverwrite(dl.Path) {
-				if verbose {
-					log.Printf("Lib \"%s\" already checked\n", dl.Path)
-				}
-				index[dl.Path] = info
-				return nil
-			}
 
-			return fmt.Errorf("lib %v was already checked but has different expectations now", dl.Path)
+	fileInfo := func(info *store.FInfo) string {
+		return fmt.Sprintf("%s (%s)", info.Hash, store.ReadableSize(float64(info.Size)))
+	}
+	fileChanges := func(title string, changes []store.FileChange) {
+		if len(changes) == 0 {
+			return
 		}
-		if verbose {
-			log.Printf("Lib \"%s\" already checked\n", dl.Path)
+		fmt.Println(title)
+		for _, c := range changes {
+			switch {
+			case c.From == nil:
+				fmt.Printf("\t+ %s\n", c.Path)
+			case c.To == nil:
+				fmt.Printf("\t- %s\n", c.Path)
+			default:
+				fmt.Printf("\t~ %s: %s -> %s\n", c.Path, fileInfo(c.From), fileInfo(c.To))
+			}
 		}
-		index[dl.Path] = info
-		return nil
 	}
 
-	fullPath := storeRoot + "libraries/" + dl.Path
-
-	info, err := getFInfo(fullPath)
-	switch {
-	case err == nil:
-
-		switch {
-		case dl.Match(info) || checkLibOverwrite(dl.Path):
-			dl.SHA1 = info.Hash
-			dl.Size = info.Size
-
-		case replace:
-			err = getFile(&dl.Download, storeRoot+"libraries/"+dl.Path)
-			if err != nil {
-				return err
-			}
-
+	if d.Jar != nil {
+		fmt.Printf("Jar: %s -> %s\n", fileInfo(d.Jar.From), fileInfo(d.Jar.To))
+	}
+	if d.MainClass != nil {
+		fmt.Printf("Main class: %s -> %s\n", d.MainClass.From, d.MainClass.To)
+	}
+	if d.AssetIndex != nil {
+		switch hash := d.AssetIndexHash; {
+		case d.AssetIndex.From != d.AssetIndex.To:
+			fmt.Printf("Assets: %s -> %s\n", d.AssetIndex.From, d.AssetIndex.To)
+		case hash != nil && hash.From != "" && hash.To != "":
+			fmt.Printf("Assets: %s, %s -> %s\n", d.AssetIndex.To, hash.From, hash.To)
 		default:
-			return fmt.Errorf("existing lib %v does not match expectations", dl.Path)
+			fmt.Printf("Assets: %s, content changed\n", d.AssetIndex.To)
 		}
-
-	case os.IsNotExist(err):
-		err = getFile(&dl.Download, storeRoot+"libraries/"+dl.Path)
-		if err != nil {
-			return err
+	}
+	if len(d.Libs) != 0 {
+		fmt.Println("Libraries:")
+		libChanges("\t", d.Libs)
+	}
+	fileChanges("Rebuilt libraries:", d.LibFiles)
+	fileChanges("Files:", d.Files)
+	if d.Mutables != nil {
+		fmt.Println("Mutables:")
+		for _, path := range d.Mutables.Added {
+			fmt.Printf("\t+ %s\n", path)
+		}
+		for _, path := range d.Mutables.Removed {
+			fmt.Printf("\t- %s\n", path)
 		}
-
-	default:
-		return err
 	}
-
-	index[dl.Path] = dl.ToFInfo()
-	checked.libs[dl.Path] = dl.ToFInfo()
-
-	return nil
 }
 
-func checkLibOld(lib *LibInfo, index FIndex) error {
-	pathList := make([]string, 0, 10)
-
-	part := strings.Split(lib.Name, ":")
-	if len(part) != 3 {
-		return fmt.Errorf("unknown lib name format \"%s\"", lib.Name)
-	}
-	part[0] = strings.Replace(part[0], ".", "/", -1)
-
-	if lib.Natives == nil {
-		pathList = append(pathList,
-			fmt.Sprintf("%s/%s/%s/%s-%s.jar", part[0], part[1], part[2], part[1], part[2]))
-	} else {
-		subDir := fmt.Sprintf("%s/%s/%s", part[0], part[1], part[2])
+func printUsage(usage []*store.PrefixUsage) {
+	size := func(n int64) string { return store.ReadableSize(float64(n)) }
+	shared := func(ss store.SharedSize) string { return size(ss.Unique) + " / " + size(ss.Shared) }
 
-		var needers []string
-		if lib.Rules != nil {
-			needers = genNeeders(lib.Rules)
-		} else {
-			needers = osList
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLIENT\tJAR\tFILES\tLIBS UNIQUE / SHARED\tASSETS UNIQUE / SHARED\tFREED")
+	for _, pu := range usage {
+		for _, vu := range pu.Versions {
+			fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\t%s\t%s\n", pu.Prefix, vu.Version,
+				size(vu.Jar), size(vu.Files), shared(vu.Libs), shared(vu.Assets), size(vu.Freed))
 		}
+		fmt.Fprintf(tw, "%s (total)\t\t\t%s\t%s\t%s\n", pu.Prefix,
+			shared(pu.Libs), shared(pu.Assets), size(pu.Freed))
+	}
+	_ = tw.Flush()
+}
 
-		for os, suffix := range lib.Natives {
-			//unknown or disallowed os
-			if !inSlice(os, needers) {
-				if !inSlice(os, osList) {
-					log.Printf("W: Unknown os \"%s\" in natives", os)
-				}
-				continue
-			}
-
-			if strings.Contains(suffix, "${arch}") {
-				for _, arch := range archList {
-					pathList = append(pathList,
-						fmt.Sprintf("%s/%s-%s-%s.jar", subDir, part[1], part[2],
-							strings.Replace(suffix, "${arch}", arch, -1)))
-				}
-			} else {
-				pathList = append(pathList,
-					fmt.Sprintf("%s/%s-%s-%s.jar", subDir, part[1], part[2], suffix))
-			}
+func printPlan(plan *store.ClonePlan) {
+	if len(plan.Versions) == 0 {
+		logger.Infof("Nothing to clone")
+		return
+	}
+	size := func(n int64) string {
+		if !plan.Estimated {
+			return "?"
 		}
+		return store.ReadableSize(float64(n))
 	}
 
-	for _, path := range pathList {
-		info, ok := checked.libs[path]
-		if ok {
-			if verbose {
-				log.Printf("Lib \"%s\" already checked\n", filepath.Base(path))
-			}
-		} else {
-			baseURL := url.Libraries
-			if len(lib.Url) > 0 {
-				baseURL = lib.Url
-			}
-			info, err := getLibOld(path, baseURL)
-			if err != nil {
-				return err
-			}
-			checked.libs[path] = info
+	logger.Infof("Clone to prefix \"%s\":", plan.Prefix)
+	// plan is a part of the log, so it goes there line by line
+	var table strings.Builder
+	tw := tabwriter.NewWriter(&table, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tTYPE\tRELEASED\tJAR\tLIBS\tASSETS")
+	for _, v := range plan.Versions {
+		released := v.Release.Format("2006-01-02")
+		if v.Exists {
+			fmt.Fprintf(tw, "%s\t%s\t%s\texists, skipped\t\t\n", v.Id, v.Type, released)
+			continue
 		}
-		index[path] = info
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", v.Id, v.Type, released,
+			size(v.Jar), size(v.Libs), size(v.Assets))
+	}
+	_ = tw.Flush()
+	for _, line := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		logger.Infof("%s", line)
+	}
+	switch {
+	case !plan.Estimated:
+		logger.Infof("Sizes are unknown in offline mode")
+	case plan.Unknown != 0:
+		logger.Infof("Estimated download size: %s, %d files of unknown size aren't counted", size(plan.Total), plan.Unknown)
+	default:
+		logger.Infof("Estimated download size: %s", size(plan.Total))
 	}
-
-	return nil
 }
 
-func genNeeders(rules []Rule) []string {
-	ns := make([]string, 0, len(osList))
-	for _, rule := range rules {
+func libChanges(indent string, libs []store.LibChange) {
+	for _, c := range libs {
 		switch {
-		case rule.Os == OsRule{} && rule.Action == "allow":
-			ns = ns[0:len(osList)]
-			copy(ns, osList)
-
-		case rule.Action == "allow":
-			ns = append(ns, rule.Os.Name)
-
-		case rule.Action == "disallow":
-			if rule.Os.Version == "" && rule.Os.Arch == "" {
-				for i, os := range ns {
-					if os == rule.Os.Name {
-						ns[i], ns = ns[len(ns)-1], ns[:len(ns)-1]
-					}
-				}
-			}
-
+		case c.From == "":
+			fmt.Printf("%s+ %s %s\n", indent, c.Name, c.To)
+		case c.To == "":
+			fmt.Printf("%s- %s %s\n", indent, c.Name, c.From)
 		default:
-			log.Fatalf("Can't handle unknown rule: %+v", rule)
+			fmt.Printf("%s~ %s %s -> %s\n", indent, c.Name, c.From, c.To)
 		}
 	}
-	return ns
 }
 
-func getLibOld(path, baseUrl string) (obj FInfo, err error) {
-	fullPath := storeRoot + "libraries/" + path
-	obj.Hash, err = readHashFile(fullPath + ".sha1")
-	if err != nil {
-		if !os.IsNotExist(err) {
-			log.Printf("While reading hash file for \"%s\": %v", filepath.Base(path), err)
+// reportUpstream prints upstream changes and returns number of clients left outdated.
+func reportUpstream(changes []*store.UpstreamChange) (n int) {
+	fmt.Println("Upstream changes:")
+	for _, c := range changes {
+		if c.Empty() {
+			fmt.Printf("%s: OK\n", c.Client)
+			continue
 		}
-		err = getFile(&Download{
-			URL: baseUrl + path + ".sha1",
-		}, fullPath+".sha1")
-		if err != nil {
-			return
+		if !c.Updated {
+			n++
 		}
-		obj.Hash, err = readHashFile(fullPath + ".sha1")
-		if err != nil {
-			return
+		switch {
+		case c.Updated:
+			fmt.Printf("%s: updated\n", c.Client)
+		case c.From != c.To:
+			fmt.Printf("%s: changed\n", c.Client)
+		default:
+			fmt.Printf("%s:\n", c.Client)
+		}
+		if c.Err != nil {
+			fmt.Printf("\tfailed: %v\n", c.Err)
+		}
+		if c.From != c.To {
+			fmt.Printf("\tjson sha1 %s -> %s\n", c.From, c.To)
+		}
+		if len(c.Fields) != 0 {
+			fmt.Printf("\tfields: %s\n", strings.Join(c.Fields, ", "))
+		}
+		if len(c.Libs) != 0 {
+			fmt.Println("\tlibraries:")
+			libChanges("\t\t", c.Libs)
+		}
+		if len(c.Overrides) != 0 {
+			fmt.Printf("\tlocal overrides: %s\n", strings.Join(c.Overrides, ", "))
 		}
-	} else if verbose {
-		log.Printf("Hash file for lib \"%s\" already exist\n", filepath.Base(path))
 	}
+	return n
+}
 
-	err = checkHash(fullPath, obj.Hash)
-	if err == nil {
-		if verbose {
-			log.Printf("Lib \"%s\" already exist\n", filepath.Base(path))
+// reportFsck prints fsck results and returns number of unrepaired problems.
+func reportFsck(report *store.FsckReport) (n int) {
+	fmt.Printf("%d files checked, %d problems found\n", report.Checked, len(report.Problems))
+	for _, p := range report.Problems {
+		if p.Repair != "" {
+			fmt.Printf("%s\t%s: %s, %s\n", p.Kind, p.Path, p.Detail, p.Repair)
+			continue
 		}
-		fi, _ := os.Stat(fullPath)
-		obj.Size = fi.Size()
-		return
+		n++
+		fmt.Printf("%s\t%s: %s\n", p.Kind, p.Path, p.Detail)
 	}
+	return n
+}
 
-	if !os.IsNotExist(err) {
-		log.Printf("%v. Regetting...", err)
+// reportMissing prints files missing in offline mode and saves them as fetch list.
+// Number of missing files is returned.
+func reportMissing(s *store.Store) int {
+	fl := s.Missing()
+	if len(fl.Files) == 0 {
+		return 0
 	}
 
-	err = getFile(&Download{
-		URL: baseUrl + path + ".sha1",
-	}, fullPath+".sha1")
-	if err != nil {
-		return
-	}
-	obj.Hash, err = readHashFile(fullPath + ".sha1")
-	if err != nil {
-		return
+	logger.Warnf("Missing files (%d):", len(fl.Files))
+	for _, item := range fl.Files {
+		logger.Infof("\t%s\t%s\t%d", item.Path, item.SHA1, item.Size)
 	}
 
-	dl := Download{
-		URL:  baseUrl + path,
-		SHA1: obj.Hash,
-	}
-	err = getFile(&dl, fullPath)
-	if err != nil {
-		return
+	if len(fetchList) != 0 {
+		if err := writeFile(fetchList, fl.Marshal()); err != nil {
+			logger.Warnf("Failed to write fetch list: %v", err)
+			return len(fl.Files)
+		}
+		logger.Infof("Fetch list saved to \"%s\"", fetchList)
 	}
-
-	return dl.ToFInfo(), nil
+	return len(fl.Files)
 }
 
-func readHashFile(full_path string) (string, error) {
-	fd, err := os.Open(full_path)
-	if err != nil {
-		return "", err
+func fetch(logger *store.Logger) error {
+	if len(listFile) == 0 || len(outFile) == 0 {
+		return fmt.Errorf("both --list and --out must be set")
 	}
-	defer fd.Close()
 
-	buf := make([]byte, 40)
-	_, err = fd.Read(buf)
-	return string(buf), err
-}
-
-func parseIndex(path string) (*ObjectList, error) {
-	fd, err := os.Open(path)
+	data, err := ioutil.ReadFile(listFile)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	list := NewObjectList()
-	decoder := json.NewDecoder(fd)
-	err = decoder.Decode(list)
-
-	_ = fd.Close()
-	return list, err
-}
-
-func collectCustoms(vers_root string) (cust *Customs, err error) {
-	log.Printf("Collecting files for \"%s\"...\n", filepath.Base(vers_root))
-
-	cust = NewCustoms()
-
-	root := vers_root + "files/"
-	if _, err := os.Stat(root); err != nil {
-		return nil, err
+	var fl store.FetchList
+	if err = json.Unmarshal(data, &fl); err != nil {
+		return fmt.Errorf("failed to parse fetch list: %v", err)
 	}
-	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return fmt.Errorf("While walking over files: %v", err)
-		}
-		if !info.IsDir() {
-			rel, err := filepath.Rel(root, path)
-			if err != nil {
-				return fmt.Errorf("Failed to determine relative path: %v", err)
-			}
-			cust.Index[rel], err = getFInfo(path)
-		}
-		return err
-	})
+
+	wr, err := createFile(outFile)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	fd, err := os.Open(vers_root + "mutables.list")
-	switch {
-	case err == nil:
-		scanner := bufio.NewScanner(fd)
-		for scanner.Scan() {
-			path := strings.TrimSpace(scanner.Text())
-			if len(path) == 0 {
-				continue
-			}
-			cust.Mutables = append(cust.Mutables, path)
-			if _, ok := cust.Index[path]; !ok {
-				log.Printf("W: File \"%s\" from mutables.list isn't present in /files/", path)
-			}
-		}
-		_ = fd.Close()
-
-		if err = scanner.Err(); err != nil {
-			return nil, fmt.Errorf("Reading mutables.list failed:", err)
-		}
-
-	case os.IsNotExist(err):
-
-	default:
-		return nil, fmt.Errorf("Reading mutables.list failed:", err)
+	if err = store.Fetch(&fl, wr, logger); err != nil {
+		_ = wr.Abort()
+		return err
 	}
-	return cust, nil
+	return wr.Commit()
 }
 
-func checkAssets(id string, dl *AssetDownload) (err error) {
-	log.Printf("Checking assets \"%s\"...\n", id)
-
-	version := id
-	key := version + ".json"
-	path := storeRoot + "assets/indexes/" + version + ".json"
-	if dl.SHA1 != "" {
-		key = dl.SHA1
-		path = storeRoot + "assets/indexes/" + dl.SHA1 + "/" + version + ".json"
-	}
-
-	if checked.indexes[key] {
-		if verbose {
-			log.Printf("Index \"%s\" already checked\n", key)
-		}
-		return nil
-	}
+// createFile returns writer, that replaces local file only on Commit.
+func createFile(name string) (store.AtomicWriter, error) {
+	return store.NewLocalStorage(filepath.Dir(name)).Create(filepath.Base(name))
+}
 
-	if err = os.MkdirAll(storeRoot+"assets/indexes/", os.ModeDir|0755); err != nil {
+func writeFile(name string, data []byte) error {
+	wr, err := createFile(name)
+	if err != nil {
 		return err
 	}
-	if err = os.MkdirAll(storeRoot+"assets/objects/", os.ModeDir|0755); err != nil {
+	if _, err = wr.Write(data); err != nil {
+		_ = wr.Abort()
 		return err
 	}
+	return wr.Commit()
+}
 
-	list, err := parseIndex(path)
-	switch {
-	case err == nil:
+func importBundle(s *store.Store, name string) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return s.ImportBundle(fd)
+}
 
-	case os.IsNotExist(err):
-		if dl.URL == "" {
-			dl.URL = url.Indexes + version + ".json"
+func cloneFilter() (filter store.CloneFilter, err error) {
+	filter.Type, filter.Since = clientType, since
+	if latest != "" {
+		if filter.Latest, err = strconv.ParseBool(latest); err != nil {
+			return filter, fmt.Errorf("--latest doesn't take value for clone")
 		}
-		err = getFile(&dl.Download, path)
+	}
+	if snapshotsAfter != "" {
+		filter.SnapshotsAfter, err = time.Parse("2006-01-02", snapshotsAfter)
 		if err != nil {
-			return err
+			filter.SnapshotsAfter, err = time.Parse(time.RFC3339, snapshotsAfter)
 		}
-		list, err = parseIndex(path)
 		if err != nil {
-			return err
+			return filter, fmt.Errorf("invalid --all-snapshots-after date \"%s\"", snapshotsAfter)
 		}
-
-	default:
-		return err
 	}
+	return filter, nil
+}
 
-	for name, a := range list.Data {
-		if checked.assets[a.Hash] {
-			if verbose {
-				log.Printf("Already checked: \"%s\"(%s)\n", name, a.Hash)
-			}
-			continue
-		}
+// checkFlags rejects --type and --latest in the form another command takes:
+// both mean prefix settings for prefix command and select clients for others.
+func checkFlags(action string, args []string) error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
 
-		if len(a.Hash) != 40 || a.Size <= 0 {
-			return fmt.Errorf("asset \"%s\"(%s) size or hash defined incorrect", name, a.Hash)
+	switch action {
+	case "prefix":
+		// value passed without "=" is taken as argument
+		if set["latest"] && !strings.Contains(latest, ":") {
+			return fmt.Errorf("prefix takes --latest=<type>:<version>[,...], value must follow \"=\"")
 		}
-
-		localPath := a.Hash[:2] + "/" + a.Hash
-
-		err := checkHash(storeRoot+"assets/objects/"+localPath, a.Hash)
-		switch {
-		case err == nil:
-			if verbose {
-				log.Printf("Exist: \"%s\"(%s)\n", name, a.Hash)
-			}
-			checked.assets[a.Hash] = true
-			continue
-
-		case strings.HasPrefix(err.Error(), "Invalid hash"):
-			return err
-
-		case os.IsNotExist(err):
-
-		default:
-			log.Printf("%v. Regetting", err)
+		if set["type"] && !store.IsPrefixType(clientType) {
+			return fmt.Errorf("prefix takes prefix type --type=public|hidden|private, got \"%s\"", clientType)
 		}
 
-		err = getFile(&Download{
-			SHA1: a.Hash,
-			Size: a.Size,
-			URL:  url.Assets + localPath,
-		}, storeRoot+"assets/objects/"+localPath)
-		if err != nil {
-			return err
+	case "clone", "daemon", "new":
+		if set["type"] && store.IsPrefixType(clientType) {
+			return fmt.Errorf("%s takes client type like --type=release, \"%s\" is prefix type, see prefix set", action, clientType)
 		}
-
-		checked.assets[a.Hash] = true
 	}
-
-	checked.indexes[key] = true
-	return
+	return nil
 }
 
-func clean() {
-	log.Println("Cleaning up...\n")
-	indexesRoot := storeRoot + "assets/indexes/"
-	dir, err := ioutil.ReadDir(indexesRoot)
-	if err != nil {
-		log.Fatal("Can't read assets indexes directory", err)
-	}
-	for _, fi := range dir {
-		if fi.IsDir() || checked.indexes[fi.Name()] {
-			continue
-		}
-		err = os.Remove(indexesRoot + fi.Name())
-		if err != nil {
-			log.Fatal("Cleanup failed:", err)
-		}
-		if verbose {
-			log.Printf("Index \"%s\" deleted", fi.Name())
-		}
-	}
-
-	libsRoot := storeRoot + "libraries/"
-	_ = filepath.Walk(libsRoot, func(path string, info os.FileInfo, err error) error {
-		if err != nil && !os.IsNotExist(err) {
-			log.Println("While walking over libraries:", err)
-		}
-		if info.IsDir() {
-			rmEmptyDirs(path)
-			return nil
-		} else {
-			log.Println(path)
-			key := strings.TrimPrefix(strings.TrimSuffix(path, ".sha1"), libsRoot)
-			_, ok := checked.libs[key]
-			if !ok && key != overwriteFile {
-				err = os.Remove(path)
-				if err != nil && !os.IsNotExist(err) {
-					log.Fatal("Fatal:", err)
-				} else if verbose {
-					log.Printf("In libs: \"%s\" deleted", info.Name())
-				}
-				rmEmptyDirs(filepath.Dir(path))
-			}
-		}
-		return nil
-	})
-
-	_ = filepath.Walk(storeRoot+"assets/objects/", func(path string, info os.FileInfo, err error) error {
-		if err != nil && !os.IsNotExist(err) {
-			log.Println("While walking over libraries:", err)
-		}
-		if info.IsDir() {
-			rmEmptyDirs(path)
-			return nil
-		} else if !checked.assets[filepath.Base(path)] {
-			err = os.Remove(path)
-			if err != nil && !os.IsNotExist(err) {
-				log.Fatal(err)
-			} else if verbose {
-				log.Printf("In assets: \"%s\" deleted", info.Name())
-			}
-			rmEmptyDirs(filepath.Dir(path))
-		}
-		return nil
-	})
+// optionalValue is a string flag, that may be passed without value like a bool one,
+// it is set to "true" then: --latest for clone, --latest=<type>:<version> for prefix.
+type optionalValue struct{ value *string }
 
-	log.Println("Cleanup finished")
+func (v optionalValue) String() string {
+	if v.value == nil {
+		return ""
+	}
+	return *v.value
 }
 
-func rmEmptyDirs(path string) (err error) {
-	flist, err := ioutil.ReadDir(path)
-	for len(flist) == 0 && err == nil {
-		err = os.Remove(path)
-		path = filepath.Dir(path)
-		flist, _ = ioutil.ReadDir(path)
-	}
-	return err
+func (v optionalValue) Set(s string) error {
+	*v.value = s
+	return nil
 }
 
-func getFile(dl *Download, destPath string) error {
-	name := filepath.Base(destPath)
+func (v optionalValue) IsBoolFlag() bool { return true }
 
-	var (
-		expectedHash []byte
-		err          error
-	)
-	if dl.SHA1 != "" {
-		expectedHash, err = hex.DecodeString(dl.SHA1)
-		if err != nil || len(expectedHash) != 20 {
-			return fmt.Errorf("invalid hash \"%s\" provided for \"%s\"", dl.SHA1, name)
-		}
-	}
+func configure() (action string, args []string, opts store.Options) {
+	opts.Root = os.Getenv("TTYH_STORE")
+	opts.Latest = make(map[string]string)
 
-	log.Printf("Getting file \"%s\"...", filepath.Base(destPath))
+	var last, ignore, hashes, s3Endpoint, logFile, logLevel string
+	var help, verbose, quiet, timestamps bool
+	var logMaxSize int64
 
-	if err := os.MkdirAll(filepath.Dir(destPath), os.ModeDir|0755); err != nil {
-		return err
-	}
+	flag.BoolVar(&help, "help", false, "generated help sucks, overwrite it")
+	flag.BoolVar(&verbose, "v", false, "")
+	flag.BoolVar(&quiet, "q", false, "")
+	flag.StringVar(&logLevel, "log-level", "", "")
+	flag.BoolVar(&timestamps, "timestamps", false, "")
+	flag.StringVar(&logFile, "log-file", "", "")
+	flag.Int64Var(&logMaxSize, "log-max-size", 10, "")
+	flag.BoolVar(&cleanup, "cleanup", false, "")
+	flag.BoolVar(&opts.Replace, "replace", false, "")
+	flag.BoolVar(&opts.Full, "full", false, "")
+	flag.BoolVar(&opts.Offline, "offline", false, "")
+	flag.StringVar(&fetchList, "fetch-list", "", "")
+	flag.StringVar(&listFile, "list", "", "")
+	flag.StringVar(&outFile, "out", "", "")
+	flag.BoolVar(&repair, "repair", false, "")
+	flag.BoolVar(&update, "update", false, "")
+	flag.StringVar(&output, "output", "text", "")
+	flag.StringVar(&from, "from", "", "")
+	flag.StringVar(&clientType, "type", "", "")
+	flag.BoolVar(&withFiles, "files", false, "")
+	flag.BoolVar(&link, "link", false, "")
+	flag.StringVar(&about, "about", "", "")
+	flag.Var(optionalValue{&latest}, "latest", "")
+	flag.StringVar(&since, "since", "", "")
+	flag.StringVar(&snapshotsAfter, "all-snapshots-after", "", "")
+	flag.StringVar(&listen, "listen", ":8080", "")
+	flag.DurationVar(&every, "every", time.Hour, "")
+	flag.BoolVar(&wait, "wait", false, "")
+	flag.BoolVar(&proxy, "proxy", false, "")
+	flag.BoolVar(&proxyMaven, "proxy-maven", false, "")
+	flag.IntVar(&opts.Jobs, "jobs", 0, "")
+	flag.StringVar(&opts.Root, "root", opts.Root, "")
+	flag.StringVar(&last, "last", "", "")
+	flag.StringVar(&ignore, "ignore", "", "")
+	flag.StringVar(&prefix, "prefix", "default", "")
+	flag.StringVar(&hashes, "hash", "", "")
+	flag.IntVar(&opts.Format, "format", store.FormatVersion, "")
+	flag.StringVar(&s3Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "")
 
-	start := time.Now()
-	resp, err := http.Get(dl.URL)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	flag.Usage = func() { fmt.Printf(helpMessage, os.Args[0]) }
+	flag.Parse()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("loading \"%s\" failed with status \"%s\"", dl.URL, resp.Status)
+	// options are also accepted between and after arguments
+	for flag.NArg() != 0 {
+		args = append(args, flag.Arg(0))
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
 	}
-
-	log.Printf("%s (%s)", resp.Status, readableSize(float64(resp.ContentLength)))
-
-	if resp.ContentLength != -1 && dl.Size != 0 && resp.ContentLength != dl.Size {
-		return fmt.Errorf("size of file \"%s\" does not match expectations", name)
+	action = "collect"
+	if len(args) != 0 {
+		action, args = args[0], args[1:]
 	}
 
-	fd, err := os.Create(destPath)
-	if err != nil {
-		return err
+	level := store.LevelInfo
+	switch {
+	case verbose && quiet:
+		fatal("-v and -q can't be used together")
+	case logLevel != "" && (verbose || quiet):
+		fatal("--log-level can't be used with -v or -q")
+	case logLevel != "":
+		var err error
+		if level, err = store.ParseLevel(logLevel); err != nil {
+			fatal("%v", err)
+		}
+	case verbose:
+		level = store.LevelDebug
+	case quiet:
+		level = store.LevelWarn
+	}
+	flags := 0
+	if timestamps {
+		flags = log.LstdFlags
+	}
+	var logOut io.Writer = os.Stdout
+	switch {
+	case logFile != "":
+		if logMaxSize <= 0 {
+			fatal("--log-max-size must be positive")
+		}
+		lf, err := openLogFile(logFile, logMaxSize<<20, logBackups)
+		if err != nil {
+			fatal("Failed to open log file: %v", err)
+		}
+		logOut = lf
+	case jsonEvents(action):
+		logOut = os.Stderr
 	}
-	defer fd.Close()
+	logger = store.NewLogger(logOut, flags, level)
+	opts.Log = logger
 
-	sha := sha1.New()
-	out := io.MultiWriter(fd, sha)
-
-	size, err := io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+	if len(opts.Root) == 0 && action != "fetch" {
+		logger.Errorf("Srote root not defined.")
+		help = true
 	}
 
-	delta := time.Now().Sub(start) + 1
-	log.Printf("Done in %v, %s/s", delta, readableSize(float64(size)*float64(time.Second)/float64(delta)))
-
-	if dl.Size != 0 && dl.Size != size {
-		return fmt.Errorf("size of file \"%s\" does not match expectations", name)
+	if help {
+		return "help", args, opts
 	}
-	hash := sha.Sum(nil)
-	if dl.SHA1 != "" && !bytes.Equal(hash, expectedHash) {
-		return fmt.Errorf("hash of file \"%s\" does not match expectations", name)
+	if err := checkFlags(action, args); err != nil {
+		fatal("%v", err)
 	}
 
-	dl.Size = size
-	dl.SHA1 = hex.EncodeToString(hash)
-	return nil
-}
-
-func readableSize(in float64) string {
-	var suffix = []string{"b", "kB", "MB", "GB", "TB", "PB"}
-	sit := 0
-	for in > 1024 {
-		in /= 1024
-		sit++
-	}
-	if sit >= len(suffix) {
-		return "over9000"
+	if strings.HasPrefix(opts.Root, "s3://") {
+		bucket := strings.TrimPrefix(opts.Root, "s3://")
+		var keyPrefix string
+		if i := strings.Index(bucket, "/"); i >= 0 {
+			bucket, keyPrefix = bucket[:i], bucket[i+1:]
+		}
+		if s3Endpoint == "" {
+			s3Endpoint = "https://s3.amazonaws.com"
+		}
+		opts.Storage = store.NewS3Storage(store.S3Config{
+			Endpoint:  s3Endpoint,
+			Region:    os.Getenv("AWS_REGION"),
+			Bucket:    bucket,
+			Prefix:    keyPrefix,
+			AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		})
 	}
-	return fmt.Sprintf("%.2f %s", in, suffix[sit])
-}
 
-func checkHash(path, hash string) error {
-	dhash, err := hex.DecodeString(hash)
-	if err != nil || len(dhash) != 20 {
-		return fmt.Errorf("invalid hash \"%s\" provided for \"%s\"", hash, filepath.Base(path))
+	if store.IsSpecialDir(prefix) || len(prefix) == 0 {
+		fatal("Passed prefix belongs to special directories")
 	}
-	fhash, err := fileHash(path)
-	if err != nil {
-		return err
-	}
-	if bytes.Equal(dhash, fhash) {
-		return nil
-	}
-	return fmt.Errorf("hash sums mismatched for \"%s\":\ndefined:\t %s \ncalicated:\t %s",
-		filepath.Base(path), hash, hex.EncodeToString(fhash))
-
-}
 
-func getFInfo(path string) (info FInfo, err error) {
-	s, err := os.Stat(path)
-	if err != nil {
-		return
+	if len(last) != 0 {
+		for _, t := range strings.Split(last, ",") {
+			part := strings.Split(t, ":")
+			if len(part) != 2 {
+				logger.Errorf("Invalid --last format in \"%s\"", t)
+				return "help", nil, opts
+			}
+			opts.Latest[part[0]] = part[1]
+		}
 	}
-	info.Size = s.Size()
 
-	fhash, err := fileHash(path)
-	if err != nil {
-		return
+	if len(ignore) != 0 {
+		opts.Ignore = strings.Split(ignore, ",")
 	}
 
-	info.Hash = hex.EncodeToString(fhash)
-	return
-}
-
-func fileHash(path string) ([]byte, error) {
-	fd, err := os.Open(path)
-	if err != nil {
-		return nil, err
+	if len(hashes) != 0 {
+		opts.Hashes = strings.Split(hashes, ",")
 	}
-	defer fd.Close()
 
-	h := sha1.New()
-	_, err = io.Copy(h, fd)
-	return h.Sum(nil), err
-}
-
-func inSlice(val string, sli []string) bool {
-	for _, t := range sli {
-		if val == t {
-			return true
-		}
-	}
-	return false
+	return action, args, opts
 }
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Drift describes differences between client files and its published data.json.
+type Drift struct {
+	// "<prefix>/<version>"
+	Client string
+	// Check failure, Changed may be incomplete if set.
+	Err error
+	// Store paths of missing libraries, assets and indexes.
+	Missing []string
+	Changed []string
+}
+
+func (d *Drift) Empty() bool {
+	return d.Err == nil && len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+// Audit performs all client checks without writing or downloading anything
+// and compares freshly computed files info with the existing data.json.
+func (s *Store) Audit(prefix, version string) *Drift {
+	w := s.newWorker()
+	w.readOnly = true
+
+	versionRoot := prefix + "/" + version + "/"
+	d := &Drift{Client: prefix + "/" + version}
+
+	_, fresh, err := w.inspectCli(versionRoot, false)
+	d.Missing = w.missed
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	var published FilesInfo
+	err = readJSON(s.st, versionRoot+"data.json", &published)
+	switch {
+	case err == nil:
+
+	case os.IsNotExist(err):
+		d.Changed = append(d.Changed, "data.json isn't published")
+		return d
+
+	default:
+		d.Err = fmt.Errorf("failed to parse data.json: %v", err)
+		return d
+	}
+
+	missing := make(map[string]bool, len(d.Missing))
+	for _, path := range d.Missing {
+		missing[path] = true
+	}
+
+	if !sameFile(published.Main, fresh.Main) {
+		d.Changed = append(d.Changed, version+".jar changed since the last collect")
+	}
+	for _, path := range diffIndex(published.Libs, fresh.Libs) {
+		if !missing["libraries/"+path] {
+			d.Changed = append(d.Changed, "lib "+path+" differs from published")
+		}
+	}
+
+	var pubFiles, freshFiles Customs
+	if published.Files != nil {
+		pubFiles = *published.Files
+	}
+	if fresh.Files != nil {
+		freshFiles = *fresh.Files
+	}
+	for _, path := range diffIndex(pubFiles.Index, freshFiles.Index) {
+		d.Changed = append(d.Changed, "file "+path+" changed since the last collect")
+	}
+	if strings.Join(pubFiles.Mutables, "\n") != strings.Join(freshFiles.Mutables, "\n") {
+		d.Changed = append(d.Changed, "mutables.list changed since the last collect")
+	}
+
+	return d
+}
+
+// AuditAll audits all clients in all prefixes, except ignored ones.
+func (s *Store) AuditAll() ([]*Drift, error) {
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return nil, fmt.Errorf("can't read store root directory: %v", err)
+	}
+
+	var drifts []*Drift
+	for _, pfi := range dir {
+		prefix := pfi.Name()
+		vdir, err := s.st.ReadDir(prefix + "/")
+		if err != nil {
+			return nil, fmt.Errorf("can't read prefix root directory: %v", err)
+		}
+		for _, fi := range vdir {
+			if !fi.IsDir || fi.Name() == "versions" || s.ignoreList[prefix+"/"+fi.Name()] {
+				continue
+			}
+			drifts = append(drifts, s.Audit(prefix, fi.Name()))
+			s.log.Println()
+		}
+	}
+	return drifts, nil
+}
+
+// sameFile compares hashes present in both infos.
+func sameFile(a, b FInfo) bool {
+	if a.SHA256 != "" && b.SHA256 != "" && a.SHA256 != b.SHA256 {
+		return false
+	}
+	return a.Hash == b.Hash && a.Size == b.Size
+}
+
+// diffIndex returns sorted paths, that are present only in one index or differ.
+func diffIndex(a, b FIndex) []string {
+	var diff []string
+	for path, ai := range a {
+		if bi, ok := b[path]; !ok || !sameFile(ai, bi) {
+			diff = append(diff, path)
+		}
+	}
+	for path := range b {
+		if _, ok := a[path]; !ok {
+			diff = append(diff, path)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
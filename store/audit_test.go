@@ -0,0 +1,36 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestAuditMissing(t *testing.T) {
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{
+		"default/1/1.json": `{"id":"1","type":"release","downloads":{"client":{"url":"http://127.0.0.1:1/1.jar","sha1":"` + sha1Hex("jar") + `","size":3}},
+			"libraries":[{"name":"a:b:1","downloads":{"artifact":{"path":"a/b/1/b-1.jar","url":"http://127.0.0.1:1/b-1.jar","sha1":"` + sha1Hex("b") + `","size":1}}}]}`,
+		"default/1/1.jar": "jar",
+	} {
+		if err = writeFile(st, path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := s.Audit("default", "1")
+	if len(d.Missing) != 1 || d.Missing[0] != "libraries/a/b/1/b-1.jar" {
+		t.Errorf("missing %v", d.Missing)
+	}
+	// audit doesn't feed fetch list of the store
+	if fl := s.Missing(); len(fl.Files) != 0 {
+		t.Errorf("store fetch list has %d files", len(fl.Files))
+	}
+	for path := range st.files {
+		if path != "default/1/1.json" && path != "default/1/1.jar" {
+			t.Errorf("%s is written by audit", path)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"archive/tar"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// bundleIndex is the first entry of bundle, fetch list with hashes and sizes of all entries.
+const bundleIndex = "bundle.json"
+
+// bundlePath reports whether path may be transferred with bundle.
+func bundlePath(p string) bool {
+	return path.Clean(p) == p &&
+		(strings.HasPrefix(p, "libraries/") || strings.HasPrefix(p, "assets/"))
+}
+
+// Fetch downloads libraries, assets and indexes from fetch list
+// and writes them to out as tar bundle laid out like the store.
+// Store isn't required, files are kept in temporary directory until written.
+func Fetch(fl *FetchList, out io.Writer, logger *Logger) error {
+	tmp, err := ioutil.TempDir("", "ttyhstore-fetch")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	s, err := New(Options{Root: tmp, Log: logger})
+	if err != nil {
+		return err
+	}
+	w := s.newWorker()
+
+	index := &FetchList{Files: make([]FetchItem, 0, len(fl.Files))}
+	for _, item := range fl.Files {
+		if !bundlePath(item.Path) {
+			w.warnf("Skipping \"%s\", only libraries and assets may be fetched", item.Path)
+			continue
+		}
+		dl := Download{URL: item.URL, SHA1: item.SHA1, Size: item.Size}
+		if err = w.getFile(&dl, item.Path); err != nil {
+			return fmt.Errorf("failed to fetch %s: %v", item.Path, err)
+		}
+		index.Files = append(index.Files, FetchItem{
+			Path: item.Path,
+			URL:  item.URL,
+			SHA1: dl.SHA1,
+			Size: dl.Size,
+		})
+	}
+
+	tw := tar.NewWriter(out)
+	now := time.Now()
+
+	data := index.Marshal()
+	err = tw.WriteHeader(&tar.Header{
+		Name:    bundleIndex,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: now,
+	})
+	if err == nil {
+		_, err = tw.Write(data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %v", err)
+	}
+
+	for _, item := range index.Files {
+		err = tw.WriteHeader(&tar.Header{
+			Name:    item.Path,
+			Mode:    0644,
+			Size:    item.Size,
+			ModTime: now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write bundle: %v", err)
+		}
+		fd, err := s.st.Open(item.Path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, fd)
+		_ = fd.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write bundle: %v", err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %v", err)
+	}
+	w.log.Printf("Bundle with %d files written", len(index.Files))
+	return nil
+}
+
+// ImportBundle places files from bundle created by Fetch to the store.
+// Every entry is verified against the bundle index, mismatched ones are skipped.
+func (s *Store) ImportBundle(r io.Reader) error {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %v", err)
+	}
+	if hdr.Name != bundleIndex {
+		return fmt.Errorf("%s expected as the first bundle entry, got \"%s\"", bundleIndex, hdr.Name)
+	}
+	var index FetchList
+	if err = json.NewDecoder(tr).Decode(&index); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", bundleIndex, err)
+	}
+	expected := make(map[string]FetchItem, len(index.Files))
+	for _, item := range index.Files {
+		expected[item.Path] = item
+	}
+
+	var imported, failed int
+	for {
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		err = s.importEntry(hdr.Name, expected, tr)
+		if err != nil {
+			s.warnf("%s: %v", hdr.Name, err)
+			failed++
+			continue
+		}
+		s.log.Debugf("Imported \"%s\"", hdr.Name)
+		imported++
+	}
+
+	s.log.Printf("Imported %d files", imported)
+	if failed != 0 {
+		return fmt.Errorf("%d bundle entries failed verification", failed)
+	}
+	return nil
+}
+
+func (s *Store) importEntry(name string, expected map[string]FetchItem, r io.Reader) error {
+	item, ok := expected[name]
+	switch {
+	case !ok:
+		return fmt.Errorf("not listed in %s", bundleIndex)
+
+	case !bundlePath(name):
+		return fmt.Errorf("only libraries and assets may be imported")
+
+	case !validHex(item.SHA1, sha1.Size):
+		return fmt.Errorf("invalid hash \"%s\" in %s", item.SHA1, bundleIndex)
+
+	case strings.HasPrefix(name, "assets/objects/") && path.Base(name) != item.SHA1:
+		return fmt.Errorf("asset name does not match its hash")
+	}
+
+	fd, err := s.st.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fd.Abort()
+
+	hs := newHashSet()
+	size, err := io.Copy(io.MultiWriter(fd, hs.Writer()), r)
+	if err != nil {
+		return err
+	}
+	info := hs.FInfo(size)
+	if info.Size != item.Size || info.Hash != strings.ToLower(item.SHA1) {
+		return fmt.Errorf("size or hash does not match expectations")
+	}
+	return fd.Commit()
+}
@@ -0,0 +1,188 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(data string) string {
+	sum := sha1.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFetchImportBundle(t *testing.T) {
+	asset := "asset content"
+	files := map[string]string{
+		"libraries/a/b/1/b-1.jar": "library content",
+		"assets/indexes/1.json":   `{"objects":{}}`,
+		"assets/objects/" + sha1Hex(asset)[:2] + "/" + sha1Hex(asset): asset,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := files[strings.TrimPrefix(req.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	fl := &FetchList{}
+	for path, data := range files {
+		fl.Files = append(fl.Files, FetchItem{
+			Path: path,
+			URL:  srv.URL + "/" + path,
+			SHA1: sha1Hex(data),
+			Size: int64(len(data)),
+		})
+	}
+	// only libraries and assets are fetched
+	fl.Files = append(fl.Files, FetchItem{Path: "default/1/1.jar", URL: srv.URL + "/default/1/1.jar"})
+
+	var bundle bytes.Buffer
+	if err := Fetch(fl, &bundle, nil); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ImportBundle(&bundle); err != nil {
+		t.Fatalf("ImportBundle: %v", err)
+	}
+	for path, data := range files {
+		checkContent(t, st, path, data)
+	}
+	if _, err = st.Stat("default/1/1.jar"); !os.IsNotExist(err) {
+		t.Errorf("client file is imported: %v", err)
+	}
+}
+
+func TestFetchMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("unexpected"))
+	}))
+	defer srv.Close()
+
+	fl := &FetchList{Files: []FetchItem{{
+		Path: "libraries/a/b/1/b-1.jar",
+		URL:  srv.URL + "/libraries/a/b/1/b-1.jar",
+		SHA1: sha1Hex("expected"),
+	}}}
+	if err := Fetch(fl, new(bytes.Buffer), nil); err == nil {
+		t.Error("file with mismatched hash is fetched")
+	}
+}
+
+type bundleEntry struct {
+	name, data string
+}
+
+// makeBundle writes bundle with passed index and entries.
+func makeBundle(t *testing.T, index []FetchItem, entries []bundleEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	data, _ := json.Marshal(FetchList{Files: index})
+	entries = append([]bundleEntry{{bundleIndex, string(data)}}, entries...)
+	for _, e := range entries {
+		err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.data))})
+		if err == nil {
+			_, err = tw.Write([]byte(e.data))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestImportBundleRejects(t *testing.T) {
+	valid := bundleEntry{"libraries/ok/1/ok-1.jar", "ok"}
+	asset := "asset"
+	assetName := "assets/objects/00/" + sha1Hex("other")
+
+	for _, tc := range []struct {
+		name  string
+		index []FetchItem
+		entry bundleEntry
+	}{
+		{
+			name:  "not listed",
+			entry: bundleEntry{"libraries/x/1/x-1.jar", "x"},
+		},
+		{
+			name:  "hash mismatch",
+			index: []FetchItem{{Path: "libraries/x/1/x-1.jar", SHA1: sha1Hex("y"), Size: 1}},
+			entry: bundleEntry{"libraries/x/1/x-1.jar", "x"},
+		},
+		{
+			name:  "size mismatch",
+			index: []FetchItem{{Path: "libraries/x/1/x-1.jar", SHA1: sha1Hex("x"), Size: 2}},
+			entry: bundleEntry{"libraries/x/1/x-1.jar", "x"},
+		},
+		{
+			name:  "asset name",
+			index: []FetchItem{{Path: assetName, SHA1: sha1Hex(asset), Size: int64(len(asset))}},
+			entry: bundleEntry{assetName, asset},
+		},
+		{
+			name:  "outside of libraries and assets",
+			index: []FetchItem{{Path: "default/1/1.jar", SHA1: sha1Hex("x"), Size: 1}},
+			entry: bundleEntry{"default/1/1.jar", "x"},
+		},
+		{
+			name:  "not clean path",
+			index: []FetchItem{{Path: "libraries/../prefixes.json", SHA1: sha1Hex("x"), Size: 1}},
+			entry: bundleEntry{"libraries/../prefixes.json", "x"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			index := append(tc.index, FetchItem{Path: valid.name, SHA1: sha1Hex(valid.data), Size: int64(len(valid.data))})
+			bundle := makeBundle(t, index, []bundleEntry{tc.entry, valid})
+
+			st := NewMemStorage()
+			s, err := New(Options{Storage: st})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = s.ImportBundle(bundle); err == nil {
+				t.Error("bundle is imported without errors")
+			}
+			if _, err = st.Stat(tc.entry.name); !os.IsNotExist(err) {
+				t.Errorf("rejected entry is imported: %v", err)
+			}
+			// other entries are imported anyway
+			checkContent(t, st, valid.name, valid.data)
+		})
+	}
+}
+
+func TestImportBundleIndex(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "libraries/x/1/x-1.jar", Mode: 0644, Size: 1})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+
+	s, err := New(Options{Storage: NewMemStorage()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ImportBundle(&buf); err == nil {
+		t.Error("bundle without index is imported")
+	}
+}
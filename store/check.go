@@ -0,0 +1,570 @@
+package store
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (w *worker) checkCli(versionRoot string, downloadJar bool) (*VInfoFull, error) {
+	version := filepath.Base(versionRoot)
+	missed := len(w.missed)
+
+	info, files, err := w.inspectCli(versionRoot, downloadJar)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := len(w.missed) - missed; n != 0 {
+		return nil, fmt.Errorf("%d files are missing", n)
+	}
+
+	err = writeFile(w.st, versionRoot+"data.json", w.marshalOutput(files))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write data.json: %v", err)
+	}
+
+	w.log.Printf("Cli \"%s\" seems to be suitable", version)
+	return info, nil
+}
+
+// inspectCli performs all client checks and computes its FilesInfo.
+// Missing files are only recorded in offline or read-only mode,
+// inspection goes on and returned FilesInfo lacks them.
+func (w *worker) inspectCli(versionRoot string, downloadJar bool) (*VInfoFull, *FilesInfo, error) {
+	version := filepath.Base(versionRoot)
+	w.client = strings.TrimSuffix(versionRoot, "/")
+
+	w.log.Printf("Checking cli \"%s\"...\n", version)
+
+	var info VInfoFull
+	err := readJSON(w.st, versionRoot+version+".json", &info)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil, err
+
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to parse %v: %v", version+".json", err)
+	}
+
+	if info.Id != version {
+		return nil, nil, fmt.Errorf("mismatched dir name & client id: \"%s\" != \"%s\"\n", version, info.Id)
+	}
+
+	w.log.Printf("%v.json: OK", version)
+
+	var files FilesInfo
+
+	jarPath := versionRoot + version + ".jar"
+	jarInfo := &info.Downloads.Client
+
+	if downloadJar {
+		err = w.getFile(jarInfo, jarPath)
+		if err != nil && err != errMissing {
+			return nil, nil, err
+		}
+	}
+
+	if err != errMissing {
+		files.Main, err = w.fileInfo(jarPath, w.algos(*jarInfo)...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !jarInfo.Match(files.Main) {
+			return nil, nil, fmt.Errorf("%s does not match expectations", version+".jar")
+		}
+
+		w.log.Printf("%v.jar: OK", version)
+	}
+
+	if len(info.Assets) != 0 {
+		err = w.checkAssets(info.Assets, &info.AssetIndex)
+		switch {
+		case err == nil:
+			w.log.Println("Assets: OK")
+
+		case err != errMissing:
+			return nil, nil, err
+		}
+	} else {
+		w.warnf("No assets defined for \"%s\"", version)
+	}
+
+	files.Files, err = w.collectCustoms(versionRoot)
+	switch {
+	case err == nil:
+		w.log.Println("Files: OK")
+
+	case os.IsNotExist(err):
+		w.log.Println("Files aren't present")
+
+	default:
+		return nil, nil, err
+	}
+
+	files.Libs, err = w.checkLibs(info.Libs)
+	switch {
+	case err == nil:
+		w.log.Println("Libraries: OK")
+
+	case err != errMissing:
+		return nil, nil, err
+	}
+
+	return &info, &files, nil
+}
+
+func (w *worker) checkLibs(libInfo []LibInfo) (FIndex, error) {
+	w.log.Println("Checking libs...")
+	index := make(FIndex)
+
+	// in offline mode check goes on, so all missing libs are listed
+	var missing error
+	for _, lib := range libInfo {
+		if lib.Downloads != nil {
+			if lib.Downloads.Artifact != (LibDownload{}) {
+				err := w.checkLib(&lib.Downloads.Artifact, index)
+				if err == errMissing {
+					missing = err
+				} else if err != nil {
+					return nil, err
+				}
+			}
+			for _, class := range lib.Downloads.Classifiers {
+				err := w.checkLib(&class, index)
+				if err == errMissing {
+					missing = err
+				} else if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			err := w.checkLibOld(&lib, index)
+			if err == errMissing {
+				missing = err
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return index, missing
+}
+
+func (s *Store) checkLibOverwrite(path string) bool {
+	for _, r := range s.libOverwrite {
+		if r.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *worker) checkLib(dl *LibDownload, index FIndex) error {
+	defer w.checked.Lock("lib:" + dl.Path)()
+
+	if info, ok := w.checked.Lib(dl.Path); ok {
+		if !dl.Match(info) {
+			if w.checkLibOverwrite(dl.Path) {
+				w.log.Debugf("Lib \"%s\" already checked\n", dl.Path)
+				index[dl.Path] = info
+				return nil
+			}
+
+			return fmt.Errorf("lib %v was already checked but has different expectations now", dl.Path)
+		}
+		w.log.Debugf("Lib \"%s\" already checked\n", dl.Path)
+		index[dl.Path] = info
+		return nil
+	}
+
+	fullPath := "libraries/" + dl.Path
+
+	info, err := w.fileInfo(fullPath, w.algos(dl.Download)...)
+	switch {
+	case err == nil:
+
+		switch {
+		case dl.Match(info) || w.checkLibOverwrite(dl.Path):
+			dl.SHA1 = info.Hash
+			dl.SHA256 = info.SHA256
+			dl.Size = info.Size
+
+		case w.replace:
+			err = w.getFile(&dl.Download, "libraries/"+dl.Path)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("existing lib %v does not match expectations", dl.Path)
+		}
+
+	case os.IsNotExist(err):
+		err = w.getFile(&dl.Download, "libraries/"+dl.Path)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return err
+	}
+
+	index[dl.Path] = dl.ToFInfo()
+	w.checked.SetLib(dl.Path, dl.ToFInfo())
+
+	return nil
+}
+
+func (w *worker) checkLibOld(lib *LibInfo, index FIndex) error {
+	pathList, err := w.oldLibPaths(lib)
+	if err != nil {
+		return err
+	}
+
+	var missing error
+	for _, path := range pathList {
+		unlock := w.checked.Lock("lib:" + path)
+		info, ok := w.checked.Lib(path)
+		if ok {
+			w.log.Debugf("Lib \"%s\" already checked\n", filepath.Base(path))
+		} else {
+			info, err = w.getLibOld(path, w.oldLibURL(lib))
+			if err == errMissing {
+				unlock()
+				missing = err
+				continue
+			} else if err != nil {
+				unlock()
+				return err
+			}
+			w.checked.SetLib(path, info)
+		}
+		unlock()
+		index[path] = info
+	}
+
+	return missing
+}
+
+// oldLibURL returns repository of library without downloads.
+func (w *worker) oldLibURL(lib *LibInfo) string {
+	if len(lib.Url) > 0 {
+		return lib.Url
+	}
+	return w.upstream.Libraries
+}
+
+// oldLibPaths returns paths of library without downloads made from its name,
+// natives for all allowed systems are included.
+func (w *worker) oldLibPaths(lib *LibInfo) ([]string, error) {
+	pathList := make([]string, 0, 10)
+
+	part := strings.Split(lib.Name, ":")
+	if len(part) != 3 {
+		return nil, fmt.Errorf("unknown lib name format \"%s\"", lib.Name)
+	}
+	part[0] = strings.Replace(part[0], ".", "/", -1)
+
+	if lib.Natives == nil {
+		pathList = append(pathList,
+			fmt.Sprintf("%s/%s/%s/%s-%s.jar", part[0], part[1], part[2], part[1], part[2]))
+	} else {
+		subDir := fmt.Sprintf("%s/%s/%s", part[0], part[1], part[2])
+
+		var needers []string
+		if lib.Rules != nil {
+			var err error
+			needers, err = genNeeders(lib.Rules)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			needers = osList
+		}
+
+		for os, suffix := range lib.Natives {
+			//unknown or disallowed os
+			if !inSlice(os, needers) {
+				if !inSlice(os, osList) {
+					w.warnf("Unknown os \"%s\" in natives", os)
+				}
+				continue
+			}
+
+			if strings.Contains(suffix, "${arch}") {
+				for _, arch := range archList {
+					pathList = append(pathList,
+						fmt.Sprintf("%s/%s-%s-%s.jar", subDir, part[1], part[2],
+							strings.Replace(suffix, "${arch}", arch, -1)))
+				}
+			} else {
+				pathList = append(pathList,
+					fmt.Sprintf("%s/%s-%s-%s.jar", subDir, part[1], part[2], suffix))
+			}
+		}
+	}
+	return pathList, nil
+}
+
+func genNeeders(rules []Rule) ([]string, error) {
+	ns := make([]string, 0, len(osList))
+	for _, rule := range rules {
+		switch {
+		case rule.Os == OsRule{} && rule.Action == "allow":
+			ns = ns[0:len(osList)]
+			copy(ns, osList)
+
+		case rule.Action == "allow":
+			ns = append(ns, rule.Os.Name)
+
+		case rule.Action == "disallow":
+			if rule.Os.Version == "" && rule.Os.Arch == "" {
+				for i, os := range ns {
+					if os == rule.Os.Name {
+						ns[i], ns = ns[len(ns)-1], ns[:len(ns)-1]
+					}
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("can't handle unknown rule: %+v", rule)
+		}
+	}
+	return ns, nil
+}
+
+func (w *worker) getLibOld(path, baseUrl string) (obj FInfo, err error) {
+	fullPath := "libraries/" + path
+	obj.Hash, err = w.readHashFile(fullPath + ".sha1")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			w.log.Warnf("While reading hash file for \"%s\": %v", filepath.Base(path), err)
+		}
+		err = w.getFile(&Download{
+			URL: baseUrl + path + ".sha1",
+		}, fullPath+".sha1")
+		if err == errMissing {
+			// hash is unknown, so the lib itself is missing as well
+			_ = w.getFile(&Download{URL: baseUrl + path}, fullPath)
+			return
+		} else if err != nil {
+			return
+		}
+		obj.Hash, err = w.readHashFile(fullPath + ".sha1")
+		if err != nil {
+			return
+		}
+	} else {
+		w.log.Debugf("Hash file for lib \"%s\" already exist\n", filepath.Base(path))
+	}
+
+	if !validHex(obj.Hash, sha1.Size) {
+		return obj, fmt.Errorf("invalid hash \"%s\" provided for \"%s\"", obj.Hash, filepath.Base(path))
+	}
+
+	info, err := w.fileInfo(fullPath, w.hashes...)
+	switch {
+	case err == nil && info.Hash == obj.Hash:
+		w.log.Debugf("Lib \"%s\" already exist\n", filepath.Base(path))
+		return info, nil
+
+	case err == nil:
+		w.log.Warnf("hash sums mismatched for \"%s\":\ndefined:\t %s \ncalicated:\t %s. Regetting...",
+			filepath.Base(path), obj.Hash, info.Hash)
+
+	case !os.IsNotExist(err):
+		w.log.Warnf("%v. Regetting...", err)
+	}
+
+	err = w.getFile(&Download{
+		URL: baseUrl + path + ".sha1",
+	}, fullPath+".sha1")
+	if err != nil {
+		return
+	}
+	obj.Hash, err = w.readHashFile(fullPath + ".sha1")
+	if err != nil {
+		return
+	}
+
+	dl := Download{
+		URL:  baseUrl + path,
+		SHA1: obj.Hash,
+	}
+	err = w.getFile(&dl, fullPath)
+	if err != nil {
+		return
+	}
+
+	return dl.ToFInfo(), nil
+}
+
+func (s *Store) readHashFile(path string) (string, error) {
+	data, err := readFile(s.st, path)
+	if err != nil {
+		return "", err
+	}
+
+	hash := strings.TrimSpace(string(data))
+	if len(hash) > 40 {
+		hash = hash[:40]
+	}
+	return hash, nil
+}
+
+func (s *Store) parseIndex(path string) (*ObjectList, error) {
+	list := NewObjectList()
+	err := readJSON(s.st, path, list)
+	return list, err
+}
+
+func (w *worker) collectCustoms(vers_root string) (cust *Customs, err error) {
+	w.log.Printf("Collecting files for \"%s\"...\n", filepath.Base(vers_root))
+
+	cust = NewCustoms()
+
+	root := vers_root + "files/"
+	if _, err := w.st.Stat(root); err != nil {
+		return nil, err
+	}
+	err = w.st.Walk(root, func(fi FileInfo) error {
+		var err error
+		cust.Index[strings.TrimPrefix(fi.Path, root)], err = w.fileInfo(fi.Path, w.hashes...)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("While walking over files: %v", err)
+	}
+
+	fd, err := w.st.Open(vers_root + "mutables.list")
+	switch {
+	case err == nil:
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			path := strings.TrimSpace(scanner.Text())
+			if len(path) == 0 {
+				continue
+			}
+			cust.Mutables = append(cust.Mutables, path)
+			if _, ok := cust.Index[path]; !ok {
+				w.warnf("File \"%s\" from mutables.list isn't present in /files/", path)
+			}
+		}
+		_ = fd.Close()
+
+		if err = scanner.Err(); err != nil {
+			return nil, fmt.Errorf("Reading mutables.list failed: %v", err)
+		}
+
+	case os.IsNotExist(err):
+
+	default:
+		return nil, fmt.Errorf("Reading mutables.list failed: %v", err)
+	}
+	return cust, nil
+}
+
+func (w *worker) checkAssets(id string, dl *AssetDownload) (err error) {
+	w.log.Printf("Checking assets \"%s\"...\n", id)
+
+	version := id
+	key, path := w.assetIndexPath(id, dl)
+
+	defer w.checked.Lock("index:" + key)()
+	if w.checked.Index(key) {
+		w.log.Debugf("Index \"%s\" already checked\n", key)
+		return nil
+	}
+
+	list, err := w.parseIndex(path)
+	switch {
+	case err == nil:
+
+	case os.IsNotExist(err):
+		if dl.URL == "" {
+			dl.URL = w.upstream.Indexes + version + ".json"
+		}
+		err = w.getFile(&dl.Download, path)
+		if err != nil {
+			return err
+		}
+		list, err = w.parseIndex(path)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return err
+	}
+
+	var missing error
+	for name, a := range list.Data {
+		err = w.checkAsset(name, a)
+		if err == errMissing {
+			missing = err
+		} else if err != nil {
+			return err
+		}
+	}
+	if missing != nil {
+		return missing
+	}
+
+	w.checked.SetIndex(key)
+	return
+}
+
+func (w *worker) checkAsset(name string, a FInfo) error {
+	defer w.checked.Lock("asset:" + a.Hash)()
+
+	if w.checked.Asset(a.Hash) {
+		w.log.Debugf("Already checked: \"%s\"(%s)\n", name, a.Hash)
+		return nil
+	}
+
+	if len(a.Hash) != 40 || a.Size <= 0 {
+		return fmt.Errorf("asset \"%s\"(%s) size or hash defined incorrect", name, a.Hash)
+	}
+
+	localPath := a.Hash[:2] + "/" + a.Hash
+
+	err := w.checkHash("assets/objects/"+localPath, a.Hash)
+	switch {
+	case err == nil:
+		w.log.Debugf("Exist: \"%s\"(%s)\n", name, a.Hash)
+		w.checked.SetAsset(a.Hash)
+		return nil
+
+	case strings.HasPrefix(err.Error(), "Invalid hash"):
+		return err
+
+	case os.IsNotExist(err):
+
+	default:
+		w.log.Warnf("%v. Regetting", err)
+	}
+
+	err = w.getFile(&Download{
+		SHA1: a.Hash,
+		Size: a.Size,
+		URL:  w.upstream.Assets + localPath,
+	}, "assets/objects/"+localPath)
+	if err != nil {
+		return err
+	}
+
+	w.checked.SetAsset(a.Hash)
+	return nil
+}
+
+// assetIndexPath returns key for checked.indexes and local path of assets index.
+func (s *Store) assetIndexPath(id string, dl *AssetDownload) (key, path string) {
+	if dl.SHA1 != "" {
+		return dl.SHA1, "assets/indexes/" + dl.SHA1 + "/" + id + ".json"
+	}
+	return id + ".json", "assets/indexes/" + id + ".json"
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (s *Store) clean() error {
+	s.log.Print("Cleaning up...\n\n")
+	indexesRoot := "assets/indexes/"
+	dir, err := s.st.ReadDir(indexesRoot)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("can't read assets indexes directory: %v", err)
+	}
+	for _, fi := range dir {
+		if fi.IsDir || s.checked.indexes[fi.Name()] {
+			continue
+		}
+		err = s.st.Remove(indexesRoot + fi.Name())
+		if err != nil {
+			return fmt.Errorf("cleanup failed: %v", err)
+		}
+		s.log.Debugf("Index \"%s\" deleted", fi.Name())
+	}
+
+	libsRoot := "libraries/"
+	err = s.st.Walk(libsRoot, func(fi FileInfo) error {
+		s.log.Debugf("%s", fi.Path)
+		key := strings.TrimPrefix(strings.TrimSuffix(fi.Path, ".sha1"), libsRoot)
+		if _, ok := s.checked.libs[key]; ok || key == overwriteFile {
+			return nil
+		}
+		err := s.st.Remove(fi.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.log.Debugf("In libs: \"%s\" deleted", fi.Name())
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cleanup failed: %v", err)
+	}
+
+	err = s.st.Walk("assets/objects/", func(fi FileInfo) error {
+		if s.checked.assets[filepath.Base(fi.Path)] {
+			return nil
+		}
+		err := s.st.Remove(fi.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.log.Debugf("In assets: \"%s\" deleted", fi.Name())
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cleanup failed: %v", err)
+	}
+
+	s.log.Println("Cleanup finished")
+	return nil
+}
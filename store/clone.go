@@ -0,0 +1,271 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Clone downloads client from official repos to prefix and checks it.
+// Upstream <version>.json is kept as is to track its changes, see UpstreamCheck.
+func (s *Store) Clone(prefix, cli string) error {
+	w := s.newWorker()
+	manifest, err := w.getManifest()
+	if err != nil {
+		return err
+	}
+	version, ok := manifest.find(cli)
+	if !ok {
+		return fmt.Errorf("requseted version not found in manifest")
+	}
+	return w.clone(prefix, &PlannedVersion{VInfoMin: version})
+}
+
+// ClonePlanned works as Clone for version of plan, <version>.json downloaded
+// by PlanClone is used, so neither it nor the manifest are requested again.
+func (s *Store) ClonePlanned(plan *ClonePlan, pv *PlannedVersion) error {
+	return s.newWorker().clone(plan.Prefix, pv)
+}
+
+func (w *worker) clone(prefix string, pv *PlannedVersion) error {
+	cli := pv.Id
+	versionRoot := prefix + "/" + cli + "/"
+	jsonPath := versionRoot + cli + ".json"
+	var err error
+	if pv.json != nil {
+		err = writeFile(w.st, jsonPath, pv.json)
+	} else {
+		err = w.getFile(&Download{URL: pv.URL}, jsonPath)
+	}
+	if err != nil {
+		return err
+	}
+	err = copyFile(w.st, jsonPath, versionRoot+upstreamFile)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %v", upstreamFile, err)
+	}
+
+	_, err = w.checkCli(versionRoot, true)
+	w.reportCheck(err, false)
+	return err
+}
+
+// getManifest downloads version manifest from upstream.
+func (w *worker) getManifest() (*VersionManifest, error) {
+	err := w.getFile(&Download{URL: w.upstream.Manifest}, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest VersionManifest
+	err = readJSON(w.st, manifestPath, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode version manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+func (m *VersionManifest) find(id string) (VInfoMin, bool) {
+	for _, v := range m.Versions {
+		if v.Id == id {
+			return v, true
+		}
+	}
+	return VInfoMin{}, false
+}
+
+// CloneFilter selects versions from the manifest, selected sets are merged.
+type CloneFilter struct {
+	// Versions of type released since version Since (inclusive),
+	// any of them may be empty.
+	Type, Since string
+	// Versions the manifest points as latest ones, of Type if it's set.
+	Latest bool
+	// Snapshots released after the time, filter is off if it is zero.
+	SnapshotsAfter time.Time
+}
+
+func (f CloneFilter) Empty() bool {
+	return f.Type == "" && f.Since == "" && !f.Latest && f.SnapshotsAfter.IsZero()
+}
+
+// ClonePlan lists versions to clone with estimated download sizes.
+// Objects already present in the store aren't subtracted.
+type ClonePlan struct {
+	Prefix   string
+	Versions []*PlannedVersion
+	// libraries and assets shared by versions are counted once
+	Total int64
+	// sizes are estimated, they are unknown in offline mode
+	Estimated bool
+	// files of unknown size, they aren't counted
+	Unknown int
+}
+
+type PlannedVersion struct {
+	VInfoMin
+	// versions selected by filter and present in prefix are skipped
+	Exists bool
+	// jar, libraries and assets sizes, zero if unknown
+	Jar, Libs, Assets int64
+
+	// <version>.json as downloaded for estimation, nil if unknown
+	json []byte
+}
+
+// PlanClone resolves explicit ids and versions selected by filter from the manifest
+// and downloads their <version>.json to estimate sizes, they are reused by ClonePlanned.
+// Versions are sorted by release time.
+// Nothing is written to prefix.
+func (s *Store) PlanClone(prefix string, ids []string, filter CloneFilter) (*ClonePlan, error) {
+	w := s.newWorker()
+	manifest, err := w.getManifest()
+	if err != nil {
+		return nil, err
+	}
+	return w.planClone(manifest, prefix, ids, filter)
+}
+
+func (w *worker) planClone(manifest *VersionManifest, prefix string, ids []string, filter CloneFilter) (*ClonePlan, error) {
+	s := w.Store
+	var err error
+	// id -> client exists, explicit ids are cloned anyway
+	selected := make(map[string]bool)
+	for _, id := range ids {
+		if _, ok := manifest.find(id); !ok {
+			return nil, fmt.Errorf("version \"%s\" not found in manifest", id)
+		}
+		selected[id] = false
+	}
+	if !filter.Empty() {
+		match, err := filter.matcher(manifest)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range manifest.Versions {
+			if _, ok := selected[v.Id]; ok || !match(v) {
+				continue
+			}
+			_, err := s.st.Stat(prefix + "/" + v.Id + "/" + v.Id + ".json")
+			selected[v.Id] = !os.IsNotExist(err)
+		}
+	}
+
+	plan := &ClonePlan{Prefix: prefix}
+	for _, v := range manifest.Versions {
+		if exists, ok := selected[v.Id]; ok {
+			plan.Versions = append(plan.Versions, &PlannedVersion{VInfoMin: v, Exists: exists})
+		}
+	}
+	sort.Slice(plan.Versions, func(i, j int) bool {
+		return plan.Versions[i].Release.Before(plan.Versions[j].Release)
+	})
+
+	// sizes are unknown in offline mode
+	if s.offline {
+		return plan, nil
+	}
+
+	// nothing is written, plan may be made for store locked by others
+	plan.Estimated = true
+	// unique libraries and assets indexes
+	libs := make(map[string]int64)
+	indexes := make(map[string]int64)
+	for _, pv := range plan.Versions {
+		if pv.Exists {
+			continue
+		}
+		if pv.json, err = w.getBytes(pv.URL); err != nil {
+			return nil, err
+		}
+		var info VInfoFull
+		if err = json.Unmarshal(pv.json, &info); err != nil {
+			return nil, fmt.Errorf("failed to parse %s.json: %v", pv.Id, err)
+		}
+		pv.Jar = info.Downloads.Client.Size
+		pv.Assets = info.AssetIndex.Size + info.AssetIndex.TotalSize
+		indexes[info.AssetIndex.ID] = pv.Assets
+		for _, lib := range info.Libs {
+			if lib.Downloads == nil {
+				w.planOldLib(plan, pv, &lib, libs)
+				continue
+			}
+			for _, dl := range lib.Downloads.Classifiers {
+				pv.Libs += dl.Size
+				libs[dl.Path] = dl.Size
+			}
+			pv.Libs += lib.Downloads.Artifact.Size
+			libs[lib.Downloads.Artifact.Path] = lib.Downloads.Artifact.Size
+		}
+		plan.Total += pv.Jar
+	}
+	for _, size := range libs {
+		plan.Total += size
+	}
+	for _, size := range indexes {
+		plan.Total += size
+	}
+	return plan, nil
+}
+
+// planOldLib counts library without downloads, its sizes are requested from its repository.
+func (w *worker) planOldLib(plan *ClonePlan, pv *PlannedVersion, lib *LibInfo, libs map[string]int64) {
+	paths, err := w.oldLibPaths(lib)
+	if err != nil {
+		w.log.Debugf("Size of \"%s\" is unknown: %v", lib.Name, err)
+		plan.Unknown++
+		return
+	}
+	for _, path := range paths {
+		size, ok := libs[path]
+		if !ok {
+			size, err = w.headSize(w.oldLibURL(lib) + path)
+			if err != nil || size < 0 {
+				w.log.Debugf("Size of \"%s\" is unknown: %v", path, err)
+				plan.Unknown++
+				continue
+			}
+			libs[path] = size
+		}
+		pv.Libs += size
+	}
+}
+
+// matcher returns function, that reports whether version is selected by filter.
+func (f CloneFilter) matcher(manifest *VersionManifest) (func(VInfoMin) bool, error) {
+	var since time.Time
+	if f.Since != "" {
+		v, ok := manifest.find(f.Since)
+		if !ok {
+			return nil, fmt.Errorf("version \"%s\" not found in manifest", f.Since)
+		}
+		since = v.Release
+	}
+
+	latest := make(map[string]bool)
+	if f.Latest {
+		for t, id := range manifest.Latest {
+			if f.Type == "" || t == f.Type {
+				latest[id] = true
+			}
+		}
+	}
+
+	// without Since, Type along with Latest selects only the latest version of the type
+	ranged := f.Since != "" || f.Type != "" && !f.Latest
+	return func(v VInfoMin) bool {
+		switch {
+		case latest[v.Id]:
+			return true
+
+		case !f.SnapshotsAfter.IsZero() && v.Type == "snapshot" && v.Release.After(f.SnapshotsAfter):
+			return true
+
+		case ranged:
+			return (f.Type == "" || v.Type == f.Type) && !v.Release.Before(since)
+		}
+		return false
+	}, nil
+}
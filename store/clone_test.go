@@ -0,0 +1,54 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlanClone(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/manifest.json":
+			_, _ = w.Write([]byte(`{"latest":{},"versions":[{"id":"1","type":"release","url":"` + srv.URL + `/1.json"}]}`))
+		case "/1.json":
+			_, _ = w.Write([]byte(`{"id":"1","type":"release",
+				"downloads":{"client":{"size":100}},
+				"assetIndex":{"id":"1","size":10,"totalSize":1000},
+				"libraries":[
+					{"name":"a:new:1","downloads":{"artifact":{"path":"a/new/1/new-1.jar","size":20}}},
+					{"name":"a.b:old:1","url":"` + srv.URL + `/repo/"}
+				]}`))
+		case "/repo/a/b/old/1/old-1.jar":
+			_, _ = w.Write(make([]byte, 7))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st, Upstream: Upstream{Manifest: srv.URL + "/manifest.json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := s.PlanClone("default", []string{"1"}, CloneFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Estimated || plan.Unknown != 0 {
+		t.Errorf("estimated %v, %d unknown files", plan.Estimated, plan.Unknown)
+	}
+	pv := plan.Versions[0]
+	if pv.Jar != 100 || pv.Libs != 27 || pv.Assets != 1010 || plan.Total != 1137 {
+		t.Errorf("jar %d, libs %d, assets %d, total %d", pv.Jar, pv.Libs, pv.Assets, plan.Total)
+	}
+	// only the manifest is kept
+	for path := range st.files {
+		if path != manifestPath {
+			t.Errorf("%s is written by plan", path)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// ClientError is returned by Collect and Cleanup if client check failed.
+type ClientError struct {
+	// "<prefix>/<version>"
+	Client string
+	Err    error
+}
+
+func (e *ClientError) Error() string {
+	return fmt.Sprintf("client \"%s\" check failed: %v", e.Client, e.Err)
+}
+
+// Collect checks all client versions,
+// generates versions.json in all prefixes and prefixes.json.
+// Nothing is published unless all prefixes are collected: data.json files are written
+// while check, then versions.json of every prefix, prefixes.json and references.json.
+func (s *Store) Collect() error {
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return fmt.Errorf("can't read store root directory: %v", err)
+	}
+	plist := NewPrefixList()
+	names := make([]string, 0, len(dir))
+	prefixes := make([]*Prefix, 0, len(dir))
+	var failed error
+	for _, fi := range dir {
+		pinfo, prefix, err := s.collectPrefix(fi.Name() + "/")
+		if err != nil {
+			// offline collect goes through all prefixes to list every missing file
+			if !s.offline {
+				return err
+			}
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		names = append(names, fi.Name())
+		prefixes = append(prefixes, prefix)
+		if pinfo.Listed() {
+			plist.Prefixes[fi.Name()] = pinfo
+		}
+	}
+	s.collected = true
+	if failed != nil {
+		return failed
+	}
+
+	for i, name := range names {
+		if err = s.publishVersions(name+"/", prefixes[i]); err != nil {
+			return err
+		}
+	}
+
+	data := s.marshalOutput(plist)
+	s.log.Printf("Generated prefixes.json with %d prefixes", len(plist.Prefixes))
+	s.log.Debugf("%s", data)
+
+	err = writeFile(s.st, "prefixes.json", data)
+	if err != nil {
+		return fmt.Errorf("failed to write prefixes.json: %v", err)
+	}
+
+	err = s.buildRefs(names)
+	if err != nil {
+		return fmt.Errorf("failed to build %s: %v", refsFile, err)
+	}
+	return nil
+}
+
+// collectPrefix checks clients of prefix and generates its versions.json content.
+func (s *Store) collectPrefix(prefixRoot string) (PrefixInfo, *Prefix, error) {
+	var err error
+	name := filepath.Base(prefixRoot)
+
+	s.log.Printf("\nJoining prefix \"%s\"\n\n", name)
+
+	pInfo := s.readPrefixInfo(prefixRoot)
+	var versions []*VInfoMin
+
+	dir, err := s.st.ReadDir(prefixRoot)
+	if err != nil {
+		return PrefixInfo{}, nil, fmt.Errorf("can't read prefix root directory: %v", err)
+	}
+
+	type result struct {
+		name string
+		w    *worker
+		info *VInfoFull
+		err  error
+		done chan struct{}
+	}
+	results := make([]*result, 0, len(dir))
+	sem := make(chan struct{}, s.jobs)
+
+	for _, fi := range dir {
+		if !fi.IsDir || fi.Name() == "versions" ||
+			s.ignoreList[name+"/"+fi.Name()] {
+			continue
+		}
+
+		r := &result{name: fi.Name(), w: s.newBufferedWorker(), done: make(chan struct{})}
+		results = append(results, r)
+		go func() {
+			sem <- struct{}{}
+			r.info, r.err = r.w.collectCli(prefixRoot + r.name + "/")
+			<-sem
+			close(r.done)
+		}()
+	}
+
+	// print logs in order, without waiting for all clients
+	var failed error
+	for _, r := range results {
+		<-r.done
+		r.w.flush()
+
+		if r.err == nil {
+			versions = append(versions, &r.info.VInfoMin)
+		} else if failed == nil {
+			s.invalids = true
+			failed = &ClientError{Client: name + "/" + r.name, Err: r.err}
+		}
+		s.log.Println()
+	}
+	if failed != nil {
+		return PrefixInfo{}, nil, failed
+	}
+
+	prefix, err := s.makePrefix(name, versions)
+	if err != nil {
+		return PrefixInfo{}, nil, err
+	}
+	s.log.Printf("\nDone in prefix \"%s\"\n\n", name)
+
+	return pInfo.PrefixInfo, prefix, nil
+}
+
+// readPrefixInfo reads prefix.json and registers its latest versions,
+// unless they are overridden by options.
+func (s *Store) readPrefixInfo(prefixRoot string) *PrefixInfoExt {
+	name := filepath.Base(prefixRoot)
+
+	var pInfo PrefixInfoExt
+	if err := readJSON(s.st, prefixRoot+"prefix.json", &pInfo); err == nil {
+		for t, v := range pInfo.Latest {
+			fullType := name + "/" + t
+			if _, ok := s.customLast[fullType]; !ok {
+				s.customLast[fullType] = v
+			}
+		}
+		if !inSlice(pInfo.Type, prefixTypes) {
+			s.warnf("Unknown type \"%s\" of prefix \"%s\"", pInfo.Type, name)
+		}
+	} else {
+		s.warnf("prefix.json read failed, use generic info")
+		pInfo.Type = "public"
+	}
+	return &pInfo
+}
+
+// publishVersions writes versions.json of prefix.
+func (s *Store) publishVersions(prefixRoot string, prefix *Prefix) error {
+	data := s.marshalOutput(prefix)
+	s.log.Printf("Generated versions.json of prefix \"%s\" with %d clients", filepath.Base(prefixRoot), len(prefix.Versions))
+	s.log.Debugf("%s", data)
+
+	err := writeFile(s.st, prefixRoot+"versions/versions.json", data)
+	if err != nil {
+		return fmt.Errorf("create versions.json failed: %v", err)
+	}
+	return nil
+}
+
+// makePrefix sorts clients and chooses latest ones by release time or custom latest.
+func (s *Store) makePrefix(name string, versions []*VInfoMin) (*Prefix, error) {
+	prefix := NewPrefix()
+	for _, vInfo := range versions {
+		prefix.Versions = append(prefix.Versions, vInfo)
+		lt, ok := prefix.latestTime[vInfo.Type]
+		if !ok || lt.Before(vInfo.Release) {
+			prefix.Latest[vInfo.Type] = vInfo.Id
+			prefix.latestTime[vInfo.Type] = vInfo.Release
+		}
+	}
+
+	sort.Sort(VersionSlice(prefix.Versions))
+
+	for t := range prefix.Latest {
+		custom, ok := s.customLast[name+"/"+t]
+		if ok {
+			valid := false
+			for _, version := range prefix.Versions {
+				if version.Id == custom {
+					if version.Type != t {
+						return nil, fmt.Errorf("in custom latest: mismatched client types for \"%s\"",
+							name+"/"+t)
+					}
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return nil, fmt.Errorf("custom latest for \"%s\" isn't consistent cli", name+"/"+t)
+			}
+
+			prefix.Latest[t] = custom
+		}
+	}
+	return prefix, nil
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ClientDiff describes changes between two clients, nil or empty fields are unchanged.
+type ClientDiff struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	Jar        *FileChange  `json:"jar,omitempty"`
+	MainClass  *ValueChange `json:"mainClass,omitempty"`
+	AssetIndex *ValueChange `json:"assetIndex,omitempty"`
+	// sha1 of assets index, set with AssetIndex, empty if unknown
+	AssetIndexHash *ValueChange `json:"assetIndexHash,omitempty"`
+	// by library name, versions are compared
+	Libs []LibChange `json:"libs,omitempty"`
+	// library files with the same path, but different content
+	LibFiles []FileChange `json:"libFiles,omitempty"`
+	Files    []FileChange `json:"files,omitempty"`
+	Mutables *ListChange  `json:"mutables,omitempty"`
+}
+
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// FileChange describes file added (From is nil), removed (To is nil) or changed.
+type FileChange struct {
+	Path string `json:"path"`
+	From *FInfo `json:"from,omitempty"`
+	To   *FInfo `json:"to,omitempty"`
+}
+
+// LibChange describes library added (From is empty), removed (To is empty) or updated.
+type LibChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+type ListChange struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func (d *ClientDiff) Empty() bool {
+	return d.Jar == nil && d.MainClass == nil && d.AssetIndex == nil &&
+		len(d.Libs) == 0 && len(d.LibFiles) == 0 && len(d.Files) == 0 && d.Mutables == nil
+}
+
+// Diff compares <version>.json and data.json of two checked clients.
+func (s *Store) Diff(fromPrefix, fromVersion, toPrefix, toVersion string) (*ClientDiff, error) {
+	d := &ClientDiff{
+		From: fromPrefix + "/" + fromVersion,
+		To:   toPrefix + "/" + toVersion,
+	}
+
+	fromInfo, fromFiles, err := s.readClient(fromPrefix, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	toInfo, toFiles, err := s.readClient(toPrefix, toVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sameFile(fromFiles.Main, toFiles.Main) {
+		d.Jar = &FileChange{Path: toVersion + ".jar", From: &fromFiles.Main, To: &toFiles.Main}
+	}
+	if fromInfo.MainClass != toInfo.MainClass {
+		d.MainClass = &ValueChange{fromInfo.MainClass, toInfo.MainClass}
+	}
+	fromKey, _ := s.assetIndexPath(fromInfo.Assets, &fromInfo.AssetIndex)
+	toKey, _ := s.assetIndexPath(toInfo.Assets, &toInfo.AssetIndex)
+	if fromKey != toKey {
+		d.AssetIndex = &ValueChange{fromInfo.Assets, toInfo.Assets}
+		d.AssetIndexHash = &ValueChange{fromInfo.AssetIndex.SHA1, toInfo.AssetIndex.SHA1}
+	}
+
+	d.Libs = diffLibs(fromInfo.Libs, toInfo.Libs)
+	for path, from := range fromFiles.Libs {
+		if to, ok := toFiles.Libs[path]; ok && !sameFile(from, to) {
+			from, to := from, to
+			d.LibFiles = append(d.LibFiles, FileChange{path, &from, &to})
+		}
+	}
+	sort.Slice(d.LibFiles, func(i, j int) bool { return d.LibFiles[i].Path < d.LibFiles[j].Path })
+
+	var fromCust, toCust Customs
+	if fromFiles.Files != nil {
+		fromCust = *fromFiles.Files
+	}
+	if toFiles.Files != nil {
+		toCust = *toFiles.Files
+	}
+	for _, path := range diffIndex(fromCust.Index, toCust.Index) {
+		change := FileChange{Path: path}
+		if info, ok := fromCust.Index[path]; ok {
+			change.From = &info
+		}
+		if info, ok := toCust.Index[path]; ok {
+			change.To = &info
+		}
+		d.Files = append(d.Files, change)
+	}
+
+	added, removed := diffList(fromCust.Mutables, toCust.Mutables)
+	if len(added) != 0 || len(removed) != 0 {
+		d.Mutables = &ListChange{added, removed}
+	}
+	return d, nil
+}
+
+func (s *Store) readClient(prefix, version string) (*VInfoFull, *FilesInfo, error) {
+	versionRoot := prefix + "/" + version + "/"
+
+	var info VInfoFull
+	if err := readJSON(s.st, versionRoot+version+".json", &info); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s.json: %v", version, err)
+	}
+
+	files := NewFilesInfo()
+	err := readJSON(s.st, versionRoot+"data.json", files)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil, fmt.Errorf("data.json of \"%s/%s\" not found, check client first", prefix, version)
+
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to read data.json of \"%s/%s\": %v", prefix, version, err)
+	}
+	return &info, files, nil
+}
+
+// libVersions maps "<group>:<artifact>[:<classifier>]" to versions
+// from "<group>:<artifact>:<version>[:<classifier>]" lib names.
+func libVersions(libs []LibInfo) map[string]string {
+	versions := make(map[string]string)
+	for _, lib := range libs {
+		parts := strings.Split(lib.Name, ":")
+		if len(parts) < 3 {
+			versions[lib.Name] = ""
+			continue
+		}
+		name, version := parts[0]+":"+parts[1], parts[2]
+		if len(parts) > 3 {
+			name += ":" + strings.Join(parts[3:], ":")
+		}
+		// the same lib may be listed several times with different rules
+		if v, ok := versions[name]; ok {
+			if !inSlice(version, strings.Split(v, ", ")) {
+				versions[name] = v + ", " + version
+			}
+			continue
+		}
+		versions[name] = version
+	}
+	return versions
+}
+
+func diffLibs(from, to []LibInfo) []LibChange {
+	fromVersions, toVersions := libVersions(from), libVersions(to)
+
+	var changes []LibChange
+	for name, v := range fromVersions {
+		if tv, ok := toVersions[name]; !ok || tv != v {
+			changes = append(changes, LibChange{name, v, tv})
+		}
+	}
+	for name, v := range toVersions {
+		if _, ok := fromVersions[name]; !ok {
+			changes = append(changes, LibChange{Name: name, To: v})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// diffList returns sorted items present only in to (added) and only in from (removed).
+func diffList(from, to []string) (added, removed []string) {
+	for _, item := range to {
+		if !inSlice(item, from) {
+			added = append(added, item)
+		}
+	}
+	for _, item := range from {
+		if !inSlice(item, to) {
+			removed = append(removed, item)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return
+}
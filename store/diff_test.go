@@ -0,0 +1,39 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLibs(t *testing.T) {
+	libs := func(names ...string) []LibInfo {
+		var list []LibInfo
+		for _, name := range names {
+			list = append(list, LibInfo{Name: name})
+		}
+		return list
+	}
+	from := libs(
+		"org.lwjgl:lwjgl:3.2.1",
+		"org.lwjgl:lwjgl:3.2.1:natives-linux",
+		"org.lwjgl:lwjgl:3.2.1:natives-windows",
+		"com.mojang:brigadier:1.0.17",
+		"com.mojang:removed:1",
+	)
+	to := libs(
+		"org.lwjgl:lwjgl:3.2.2",
+		"org.lwjgl:lwjgl:3.2.2:natives-linux",
+		"org.lwjgl:lwjgl:3.2.1:natives-windows",
+		"com.mojang:brigadier:1.0.17",
+		"com.mojang:added:2",
+	)
+	want := []LibChange{
+		{Name: "com.mojang:added", To: "2"},
+		{Name: "com.mojang:removed", From: "1"},
+		{Name: "org.lwjgl:lwjgl", From: "3.2.1", To: "3.2.2"},
+		{Name: "org.lwjgl:lwjgl:natives-linux", From: "3.2.1", To: "3.2.2"},
+	}
+	if got := diffLibs(from, to); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
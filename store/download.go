@@ -0,0 +1,142 @@
+package store
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// statusError is returned by getFile if upstream responds with unexpected status.
+type statusError struct {
+	url, status string
+	code        int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("loading \"%s\" failed with status \"%s\"", e.url, e.status)
+}
+
+func (w *worker) getFile(dl *Download, destPath string) error {
+	name := filepath.Base(destPath)
+
+	if dl.SHA1 != "" && !validHex(dl.SHA1, sha1.Size) {
+		return fmt.Errorf("invalid hash \"%s\" provided for \"%s\"", dl.SHA1, name)
+	}
+	if dl.SHA256 != "" && !validHex(dl.SHA256, sha256.Size) {
+		return fmt.Errorf("invalid sha256 \"%s\" provided for \"%s\"", dl.SHA256, name)
+	}
+
+	switch {
+	case w.readOnly:
+		return w.presentFile(dl, destPath)
+	case w.offline:
+		return w.offlineFile(dl, destPath)
+	}
+
+	w.log.Debugf("Getting file \"%s\"...", filepath.Base(destPath))
+
+	start := time.Now()
+	resp, err := http.Get(dl.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &statusError{url: dl.URL, status: resp.Status, code: resp.StatusCode}
+	}
+
+	w.log.Debugf("%s (%s)", resp.Status, ReadableSize(float64(resp.ContentLength)))
+
+	if resp.ContentLength != -1 && dl.Size != 0 && resp.ContentLength != dl.Size {
+		return fmt.Errorf("size of file \"%s\" does not match expectations", name)
+	}
+
+	// nothing is published unless file matches expectations
+	fd, err := w.st.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer fd.Abort()
+
+	hs := newHashSet(w.algos(*dl)...)
+	out := io.MultiWriter(fd, hs.Writer())
+
+	size, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return err
+	}
+
+	delta := time.Now().Sub(start) + 1
+	w.log.Debugf("Done in %v, %s/s", delta, ReadableSize(float64(size)*float64(time.Second)/float64(delta)))
+
+	if dl.Size != 0 && dl.Size != size {
+		return fmt.Errorf("size of file \"%s\" does not match expectations", name)
+	}
+	info := hs.FInfo(size)
+	if dl.SHA1 != "" && info.Hash != strings.ToLower(dl.SHA1) {
+		return fmt.Errorf("hash of file \"%s\" does not match expectations", name)
+	}
+	if dl.SHA256 != "" && info.SHA256 != strings.ToLower(dl.SHA256) {
+		return fmt.Errorf("sha256 of file \"%s\" does not match expectations", name)
+	}
+
+	if err = fd.Commit(); err != nil {
+		return err
+	}
+
+	dl.Size = size
+	dl.SHA1 = info.Hash
+	dl.SHA256 = info.SHA256
+	w.emit(Event{Type: EventDownloaded, Client: w.client, Path: destPath, URL: dl.URL, Size: size})
+	return nil
+}
+
+// ReadableSize formats size in bytes with binary prefix.
+func ReadableSize(in float64) string {
+	var suffix = []string{"b", "kB", "MB", "GB", "TB", "PB"}
+	sit := 0
+	for in > 1024 {
+		in /= 1024
+		sit++
+	}
+	if sit >= len(suffix) {
+		return "over9000"
+	}
+	return fmt.Sprintf("%.2f %s", in, suffix[sit])
+}
+
+// getBytes downloads small file to memory without storing it.
+func (w *worker) getBytes(url string) ([]byte, error) {
+	w.log.Debugf("Getting \"%s\"...", url)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, &statusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// headSize requests size of file without downloading it, -1 is returned if it isn't reported.
+func (w *worker) headSize(url string) (int64, error) {
+	resp, err := http.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, &statusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+	return resp.ContentLength, nil
+}
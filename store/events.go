@@ -0,0 +1,62 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event types, see Options.Events.
+const (
+	// client check finished, Message holds error if it failed
+	EventChecked = "checked"
+	// file downloaded from upstream
+	EventDownloaded = "downloaded"
+	EventWarning    = "warning"
+	// fatal error, emitted by callers
+	EventError = "error"
+)
+
+// Event is structured progress event.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// "<prefix>/<version>" the event relates to, if any
+	Client string `json:"client,omitempty"`
+	Path   string `json:"path,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	// client is unchanged since the last collect, so it isn't checked again
+	Reused  bool   `json:"reused,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *Store) emit(e Event) {
+	if s.events == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	s.events(e)
+}
+
+// warnf logs warning and emits it as event.
+func (s *Store) warnf(format string, v ...interface{}) {
+	msg := strings.TrimSpace(fmt.Sprintf(format, v...))
+	s.log.Warnf("%s", msg)
+	s.emit(Event{Type: EventWarning, Message: msg})
+}
+
+func (w *worker) warnf(format string, v ...interface{}) {
+	msg := strings.TrimSpace(fmt.Sprintf(format, v...))
+	w.log.Warnf("%s", msg)
+	w.emit(Event{Type: EventWarning, Client: w.client, Message: msg})
+}
+
+// reportCheck emits result of client check.
+func (w *worker) reportCheck(err error, reused bool) {
+	e := Event{Type: EventChecked, Client: w.client, Reused: reused}
+	if err != nil {
+		e.Message = err.Error()
+	}
+	w.emit(e)
+}
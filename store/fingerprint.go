@@ -0,0 +1,189 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const fingerprintFile = ".fingerprint.json"
+
+// Fingerprint describes client sources checkCli depends on.
+// If it stays the same, the existing data.json is still valid.
+type Fingerprint struct {
+	JSON     string           `json:"json"`
+	Jar      FStat            `json:"jar"`
+	Files    map[string]FStat `json:"files"`
+	Mutables string           `json:"mutables"`
+	// generation options, that affect data.json
+	Hashes []string `json:"hashes"`
+	Format int      `json:"format"`
+}
+
+type FStat struct {
+	Size  int64 `json:"size"`
+	MTime int64 `json:"mtime"`
+}
+
+func statFile(info FileInfo) FStat {
+	return FStat{info.Size, info.ModTime.UnixNano()}
+}
+
+func (s *Store) makeFingerprint(versionRoot string) (*Fingerprint, error) {
+	version := filepath.Base(versionRoot)
+	fp := &Fingerprint{
+		Files:  make(map[string]FStat),
+		Hashes: s.hashes,
+		Format: s.format,
+	}
+
+	info, err := s.fileInfo(versionRoot + version + ".json")
+	if err != nil {
+		return nil, err
+	}
+	fp.JSON = info.Hash
+
+	stat, err := s.st.Stat(versionRoot + version + ".jar")
+	if err != nil {
+		return nil, err
+	}
+	fp.Jar = statFile(stat)
+
+	info, err = s.fileInfo(versionRoot + "mutables.list")
+	switch {
+	case err == nil:
+		fp.Mutables = info.Hash
+
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	root := versionRoot + "files/"
+	err = s.st.Walk(root, func(fi FileInfo) error {
+		fp.Files[strings.TrimPrefix(fi.Path, root)] = statFile(fi)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fp, nil
+}
+
+func (fp *Fingerprint) Equal(other *Fingerprint) bool {
+	a, _ := json.Marshal(fp)
+	b, _ := json.Marshal(other)
+	return bytes.Equal(a, b)
+}
+
+func (s *Store) readFingerprint(versionRoot string) (*Fingerprint, error) {
+	data, err := readFile(s.st, versionRoot+fingerprintFile)
+	if err != nil {
+		return nil, err
+	}
+	var fp Fingerprint
+	err = json.Unmarshal(data, &fp)
+	return &fp, err
+}
+
+func (s *Store) writeFingerprint(versionRoot string, fp *Fingerprint) error {
+	data, _ := json.MarshalIndent(fp, "", "  ")
+	return writeFile(s.st, versionRoot+fingerprintFile, data)
+}
+
+// collectCli checks client unless it is unchanged since the last collect.
+func (w *worker) collectCli(versionRoot string) (info *VInfoFull, err error) {
+	// reused client isn't inspected, events still need its name
+	w.client = strings.TrimSuffix(versionRoot, "/")
+	reused := false
+	defer func() { w.reportCheck(err, reused) }()
+
+	fp, err := w.makeFingerprint(versionRoot)
+	if err != nil {
+		// let checkCli report what exactly is wrong
+		return w.checkCli(versionRoot, false)
+	}
+
+	if !w.full {
+		if old, err := w.readFingerprint(versionRoot); err == nil && fp.Equal(old) {
+			info, err := w.reuseCli(versionRoot)
+			if err == nil {
+				reused = true
+				return info, nil
+			}
+			w.warnf("Failed to reuse data.json: %v", err)
+		}
+	}
+
+	info, err = w.checkCli(versionRoot, false)
+	if err != nil {
+		_ = w.st.Remove(versionRoot + fingerprintFile)
+		return nil, err
+	}
+
+	err = w.writeFingerprint(versionRoot, fp)
+	if err != nil {
+		w.warnf("Failed to save fingerprint: %v", err)
+	}
+	return info, nil
+}
+
+// reuseCli loads client info and existing data.json
+// and marks libraries and assets used by client as checked.
+func (w *worker) reuseCli(versionRoot string) (*VInfoFull, error) {
+	version := filepath.Base(versionRoot)
+
+	var info VInfoFull
+	data, err := readFile(w.st, versionRoot+version+".json")
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", version+".json", err)
+	}
+	if info.Id != version {
+		return nil, fmt.Errorf("mismatched dir name & client id: \"%s\" != \"%s\"", version, info.Id)
+	}
+
+	data, err = readFile(w.st, versionRoot+"data.json")
+	if err != nil {
+		return nil, err
+	}
+	var files FilesInfo
+	if err = json.Unmarshal(data, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse data.json: %v", err)
+	}
+
+	for path, lib := range files.Libs {
+		unlock := w.checked.Lock("lib:" + path)
+		prev, ok := w.checked.Lib(path)
+		if ok && prev.Hash != lib.Hash && !w.checkLibOverwrite(path) {
+			unlock()
+			return nil, fmt.Errorf("lib %v was already checked but has different expectations now", path)
+		}
+		w.checked.SetLib(path, lib)
+		unlock()
+	}
+
+	if len(info.Assets) != 0 {
+		key, path := w.assetIndexPath(info.Assets, &info.AssetIndex)
+		unlock := w.checked.Lock("index:" + key)
+		defer unlock()
+		if !w.checked.Index(key) {
+			list, err := w.parseIndex(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range list.Data {
+				w.checked.SetAsset(a.Hash)
+			}
+			w.checked.SetIndex(key)
+		}
+	}
+
+	w.log.Printf("Cli \"%s\" is unchanged since the last collect", version)
+	return &info, nil
+}
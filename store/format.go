@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// FormatVersion of generated json files.
+// 1 - legacy files without formatVersion field
+// 2 - formatVersion field and optional sha256 hashes
+const FormatVersion = 2
+
+// versioned is implemented by every generated json structure.
+type versioned interface {
+	format() int
+	setFormat(version int)
+}
+
+func (p *Prefix) format() int { return effectiveFormat(p.FormatVersion) }
+
+func (p *Prefix) setFormat(version int) { p.FormatVersion = fieldFormat(version) }
+
+func (pl *PrefixList) format() int { return effectiveFormat(pl.FormatVersion) }
+
+func (pl *PrefixList) setFormat(version int) { pl.FormatVersion = fieldFormat(version) }
+
+func (f *FilesInfo) format() int { return effectiveFormat(f.FormatVersion) }
+
+func (f *FilesInfo) setFormat(version int) {
+	f.FormatVersion = fieldFormat(version)
+	if version >= 2 {
+		return
+	}
+
+	f.Main.SHA256 = ""
+	f.Libs.stripSHA256()
+	if f.Files != nil {
+		f.Files.Index.stripSHA256()
+	}
+}
+
+func (index FIndex) stripSHA256() {
+	for path, info := range index {
+		info.SHA256 = ""
+		index[path] = info
+	}
+}
+
+func effectiveFormat(field int) int {
+	if field == 0 {
+		return 1
+	}
+	return field
+}
+
+func fieldFormat(version int) int {
+	if version < 2 {
+		return 0
+	}
+	return version
+}
+
+// marshalOutput converts v to the requested output format and encodes it.
+func (s *Store) marshalOutput(v versioned) []byte {
+	v.setFormat(s.format)
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return data
+}
+
+func (s *Store) migrateFile(path string, v versioned) error {
+	err := readJSON(s.st, path, v)
+	switch {
+	case os.IsNotExist(err):
+		return err
+
+	case err != nil:
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	if v.format() > FormatVersion {
+		return fmt.Errorf("%s has unsupported format %d", path, v.format())
+	}
+	if v.format() == s.format {
+		s.log.Debugf("\"%s\" is up to date", path)
+		return nil
+	}
+
+	from := v.format()
+	err = writeFile(s.st, path, s.marshalOutput(v))
+	if err != nil {
+		return err
+	}
+	s.log.Printf("\"%s\": %d -> %d", path, from, s.format)
+	return nil
+}
+
+// Migrate rewrites generated prefixes.json, versions.json and data.json files
+// to the configured format without checking clients.
+func (s *Store) Migrate() error {
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range dir {
+		prefixRoot := fi.Name() + "/"
+
+		err = s.migrateFile(prefixRoot+"versions/versions.json", NewPrefix())
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		versions, err := s.st.ReadDir(prefixRoot)
+		if err != nil {
+			return err
+		}
+		for _, vi := range versions {
+			if !vi.IsDir || vi.Name() == "versions" {
+				continue
+			}
+			err = s.migrateFile(prefixRoot+vi.Name()+"/data.json", NewFilesInfo())
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	err = s.migrateFile("prefixes.json", NewPrefixList())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+package store
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// quarantineDir keeps files moved away by fsck repair, it is skipped as a prefix.
+const quarantineDir = ".quarantine/"
+
+// Problem kinds reported by Fsck.
+const (
+	// file content doesn't match its hash
+	FsckCorrupt = "corrupt"
+	// file doesn't belong to the store layout
+	FsckStray = "stray"
+	// object referenced by an assets index isn't present
+	FsckMissing = "missing"
+	// library has neither hash file nor hash in data.json of any client, it's left as is
+	FsckUnverified = "unverified"
+)
+
+type FsckProblem struct {
+	Path   string
+	Kind   string
+	Detail string
+	// Action taken by repair, empty if none.
+	Repair string
+
+	// source for repair, if file may be fetched
+	url  string
+	sha1 string
+	size int64
+}
+
+type FsckReport struct {
+	Checked  int
+	Problems []FsckProblem
+
+	missing map[string]bool
+}
+
+// Fsck verifies whole store: assets objects against their names,
+// libraries against .sha1 files or hashes in data.json of clients and assets indexes,
+// including files not referenced by any client.
+// With repair corrupt objects are fetched from upstream again,
+// anything that can't be fetched is moved to quarantine.
+func (s *Store) Fsck(repair bool) (*FsckReport, error) {
+	w := s.newWorker()
+	r := &FsckReport{missing: make(map[string]bool)}
+
+	s.log.Println("Checking assets objects...")
+	err := s.st.Walk("assets/objects/", func(fi FileInfo) error {
+		r.Checked++
+		if isTempFile(fi.Name()) {
+			r.add(FsckProblem{Path: fi.Path, Kind: FsckStray, Detail: "leftover of interrupted write"})
+			return nil
+		}
+		hash := fi.Name()
+		if !validHex(hash, sha1.Size) || fi.Path != "assets/objects/"+hash[:2]+"/"+hash {
+			r.add(FsckProblem{Path: fi.Path, Kind: FsckStray, Detail: "not named by hash"})
+			return nil
+		}
+		return w.fsckFile(r, fi.Path, hash, w.upstream.Assets+hash[:2]+"/"+hash)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk assets objects: %v", err)
+	}
+
+	s.log.Println("Checking libraries...")
+	sources, err := w.libSources()
+	if err != nil {
+		return nil, err
+	}
+	err = s.st.Walk("libraries/", func(fi FileInfo) error {
+		r.Checked++
+		switch {
+		case fi.Path == "libraries/"+overwriteFile:
+			return nil
+
+		case isTempFile(fi.Name()):
+			r.add(FsckProblem{Path: fi.Path, Kind: FsckStray, Detail: "leftover of interrupted write"})
+			return nil
+
+		case strings.HasSuffix(fi.Path, ".sha1"):
+			if _, err := s.st.Stat(strings.TrimSuffix(fi.Path, ".sha1")); os.IsNotExist(err) {
+				r.add(FsckProblem{Path: fi.Path, Kind: FsckStray, Detail: "hash file without library"})
+			}
+			return nil
+		}
+
+		lib := strings.TrimPrefix(fi.Path, "libraries/")
+		src, ok := sources[lib]
+		if !ok {
+			src = new(libSource)
+		}
+		url := w.upstream.Libraries + lib
+		if src.url != "" {
+			url = src.url
+		}
+		hash, err := s.readHashFile(fi.Path + ".sha1")
+		switch {
+		case os.IsNotExist(err):
+			// libs with hashes in <version>.json don't have hash files
+			return w.fsckLib(r, fi.Path, src.hashes, url)
+
+		case err != nil:
+			return err
+
+		case !validHex(hash, sha1.Size):
+			r.add(FsckProblem{Path: fi.Path + ".sha1", Kind: FsckCorrupt, Detail: "invalid hash"})
+			return nil
+		}
+		return w.fsckFile(r, fi.Path, hash, url)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk libraries: %v", err)
+	}
+
+	s.log.Println("Checking assets indexes...")
+	err = s.st.Walk("assets/indexes/", func(fi FileInfo) error {
+		r.Checked++
+		if isTempFile(fi.Name()) {
+			r.add(FsckProblem{Path: fi.Path, Kind: FsckStray, Detail: "leftover of interrupted write"})
+			return nil
+		}
+		return w.fsckIndex(r, fi.Path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk assets indexes: %v", err)
+	}
+
+	dir, err := s.st.ReadDir("assets/")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("can't read assets directory: %v", err)
+	}
+	for _, fi := range dir {
+		switch {
+		case fi.Name() == "objects" || fi.Name() == "indexes":
+
+		case fi.IsDir:
+			err = s.st.Walk("assets/"+fi.Name()+"/", func(fi FileInfo) error {
+				r.add(FsckProblem{Path: fi.Path, Kind: FsckStray, Detail: "unknown assets directory"})
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to walk assets: %v", err)
+			}
+
+		default:
+			r.add(FsckProblem{Path: "assets/" + fi.Name(), Kind: FsckStray, Detail: "unknown assets file"})
+		}
+	}
+
+	if repair {
+		for i := range r.Problems {
+			w.repair(&r.Problems[i])
+		}
+	}
+	return r, nil
+}
+
+// libSource tells how library is expected to be by clients using it.
+type libSource struct {
+	// distinct hashes from data.json
+	hashes []string
+	// download url from <version>.json, empty if upstream one is used
+	url string
+}
+
+// isTempFile reports whether file is leftover of interrupted atomic write, see LocalStorage.Create.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp")
+}
+
+// libSources collects hashes of libraries from data.json and their urls from <version>.json
+// of all clients, path relative to libraries/ -> source.
+func (w *worker) libSources() (map[string]*libSource, error) {
+	s := w.Store
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return nil, fmt.Errorf("can't read store root directory: %v", err)
+	}
+
+	sources := make(map[string]*libSource)
+	source := func(path string) *libSource {
+		src, ok := sources[path]
+		if !ok {
+			src = new(libSource)
+			sources[path] = src
+		}
+		return src
+	}
+	for _, pfi := range dir {
+		vdir, err := s.st.ReadDir(pfi.Name() + "/")
+		if err != nil {
+			return nil, fmt.Errorf("can't read prefix root directory: %v", err)
+		}
+		for _, fi := range vdir {
+			if !fi.IsDir || fi.Name() == "versions" {
+				continue
+			}
+			files := NewFilesInfo()
+			err = readJSON(s.st, pfi.Name()+"/"+fi.Name()+"/data.json", files)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read data.json of \"%s/%s\": %v", pfi.Name(), fi.Name(), err)
+			}
+			for path, info := range files.Libs {
+				src, hash := source(path), strings.ToLower(info.Hash)
+				if !inSlice(hash, src.hashes) {
+					src.hashes = append(src.hashes, hash)
+				}
+			}
+
+			var info VInfoFull
+			if err = readJSON(s.st, pfi.Name()+"/"+fi.Name()+"/"+fi.Name()+".json", &info); err != nil {
+				continue
+			}
+			for path, url := range w.libURLs(info.Libs) {
+				if src := source(path); src.url == "" && url != w.upstream.Libraries+path {
+					src.url = url
+				}
+			}
+		}
+	}
+	return sources, nil
+}
+
+// libURLs returns download urls of libraries, path relative to libraries/ -> url.
+func (w *worker) libURLs(libs []LibInfo) map[string]string {
+	urls := make(map[string]string)
+	for i := range libs {
+		lib := &libs[i]
+		if lib.Downloads == nil {
+			paths, err := w.oldLibPaths(lib)
+			if err != nil {
+				continue
+			}
+			for _, path := range paths {
+				urls[path] = w.oldLibURL(lib) + path
+			}
+			continue
+		}
+		if dl := lib.Downloads.Artifact; dl.Path != "" && dl.URL != "" {
+			urls[dl.Path] = dl.URL
+		}
+		for _, dl := range lib.Downloads.Classifiers {
+			if dl.Path != "" && dl.URL != "" {
+				urls[dl.Path] = dl.URL
+			}
+		}
+	}
+	return urls
+}
+
+func (r *FsckReport) add(p FsckProblem) {
+	r.Problems = append(r.Problems, p)
+}
+
+// fsckFile checks file content against hash.
+func (w *worker) fsckFile(r *FsckReport, path, hash, url string) error {
+	info, err := w.fileInfo(path)
+	if err != nil {
+		return err
+	}
+	if info.Hash != strings.ToLower(hash) {
+		r.add(FsckProblem{Path: path, Kind: FsckCorrupt, Detail: "sha1 " + info.Hash + ", expected " + hash, url: url, sha1: hash})
+	}
+	return nil
+}
+
+// fsckLib checks library without hash file against hashes from data.json,
+// it may match any of them, since clients may override libraries.
+func (w *worker) fsckLib(r *FsckReport, path string, hashes []string, url string) error {
+	if len(hashes) == 0 {
+		r.add(FsckProblem{Path: path, Kind: FsckUnverified, Detail: "no hash file and not used by any client"})
+		return nil
+	}
+	if len(hashes) == 1 {
+		return w.fsckFile(r, path, hashes[0], url)
+	}
+
+	info, err := w.fileInfo(path)
+	if err != nil {
+		return err
+	}
+	if !inSlice(info.Hash, hashes) {
+		// expected hash is ambiguous, so repair can't fetch it
+		r.add(FsckProblem{Path: path, Kind: FsckCorrupt, Detail: "sha1 " + info.Hash + ", expected one of " + strings.Join(hashes, ", ")})
+	}
+	return nil
+}
+
+// fsckIndex checks that index is parsable, matches its hash if it is stored by one
+// and all referenced objects are present.
+func (w *worker) fsckIndex(r *FsckReport, p string) error {
+	rel := strings.TrimPrefix(p, "assets/indexes/")
+	if dir := path.Dir(rel); dir != "." {
+		if !validHex(dir, sha1.Size) || strings.Contains(dir, "/") {
+			r.add(FsckProblem{Path: p, Kind: FsckStray, Detail: "unknown index location"})
+			return nil
+		}
+		info, err := w.fileInfo(p)
+		if err != nil {
+			return err
+		}
+		if info.Hash != dir {
+			r.add(FsckProblem{Path: p, Kind: FsckCorrupt, Detail: "sha1 " + info.Hash + ", expected " + dir})
+			return nil
+		}
+	}
+
+	list, err := w.parseIndex(p)
+	if err != nil {
+		r.add(FsckProblem{Path: p, Kind: FsckCorrupt, Detail: err.Error()})
+		return nil
+	}
+	for name, a := range list.Data {
+		if !validHex(a.Hash, sha1.Size) {
+			r.add(FsckProblem{Path: p, Kind: FsckCorrupt, Detail: fmt.Sprintf("invalid hash for \"%s\"", name)})
+			return nil
+		}
+		objPath := "assets/objects/" + a.Hash[:2] + "/" + a.Hash
+		if r.missing[objPath] {
+			continue
+		}
+		_, err = w.st.Stat(objPath)
+		switch {
+		case os.IsNotExist(err):
+			r.missing[objPath] = true
+			r.add(FsckProblem{
+				Path:   objPath,
+				Kind:   FsckMissing,
+				Detail: "referenced by " + rel,
+				url:    w.upstream.Assets + a.Hash[:2] + "/" + a.Hash,
+				sha1:   a.Hash,
+				size:   a.Size,
+			})
+
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// repair fetches corrupt or missing file again, moves to quarantine anything else
+// except unverified libraries.
+func (w *worker) repair(p *FsckProblem) {
+	if p.Kind == FsckUnverified {
+		return
+	}
+	if p.url != "" {
+		err := w.getFile(&Download{URL: p.url, SHA1: p.sha1, Size: p.size}, p.Path)
+		if err == nil {
+			p.Repair = "fetched"
+			return
+		}
+		w.warnf("Failed to fetch \"%s\": %v", p.Path, err)
+		if p.Kind == FsckMissing {
+			return
+		}
+	}
+
+	if err := moveFile(w.st, p.Path, quarantineDir+p.Path); err != nil {
+		w.warnf("Failed to quarantine \"%s\": %v", p.Path, err)
+		return
+	}
+	p.Repair = "quarantined"
+}
+
+// moveFile moves file within storage by copying it.
+func moveFile(st Storage, from, to string) error {
+	if err := copyFile(st, from, to); err != nil {
+		return err
+	}
+	return st.Remove(from)
+}
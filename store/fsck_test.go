@@ -0,0 +1,59 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFsckRepair(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+		if req.URL.Path != "/custom/a/b/1/b-1.jar" {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write([]byte("lib"))
+	}))
+	defer srv.Close()
+
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st, Upstream: Upstream{Libraries: srv.URL + "/upstream/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := "libraries/a/b/1/.b-1.jar.tmp123"
+	for path, data := range map[string]string{
+		"default/1/1.json": `{"id":"1","type":"release","libraries":[{"name":"a:b:1","downloads":{"artifact":{"path":"a/b/1/b-1.jar","url":"` +
+			srv.URL + `/custom/a/b/1/b-1.jar","sha1":"` + sha1Hex("lib") + `","size":3}}}]}`,
+		"default/1/data.json":     `{"main":{"hash":"` + sha1Hex("") + `","size":0},"libs":{"a/b/1/b-1.jar":{"hash":"` + sha1Hex("lib") + `","size":3}}}`,
+		"libraries/a/b/1/b-1.jar": "corrupt",
+		tmp:                       "partial",
+	} {
+		if err = writeFile(st, path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := s.Fsck(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := make(map[string]FsckProblem)
+	for _, p := range r.Problems {
+		problems[p.Path] = p
+	}
+	if p := problems["libraries/a/b/1/b-1.jar"]; p.Kind != FsckCorrupt || p.Repair != "fetched" {
+		t.Errorf("library: %+v, requested %v", p, requested)
+	}
+	checkContent(t, st, "libraries/a/b/1/b-1.jar", "lib")
+
+	if p := problems[tmp]; p.Kind != FsckStray || p.Repair != "quarantined" {
+		t.Errorf("temp file: %+v", p)
+	}
+	if _, err = st.Stat(tmp); !os.IsNotExist(err) {
+		t.Errorf("temp file is left: %v", err)
+	}
+}
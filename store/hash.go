@@ -0,0 +1,110 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+)
+
+// sha1 is always computed, anything else only on request
+var hashFuncs = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// hashSet computes sha1 and requested algorithms in a single pass.
+type hashSet map[string]hash.Hash
+
+func newHashSet(algos ...string) hashSet {
+	hs := hashSet{"sha1": sha1.New()}
+	for _, name := range algos {
+		if _, ok := hs[name]; !ok {
+			hs[name] = hashFuncs[name]()
+		}
+	}
+	return hs
+}
+
+func (hs hashSet) Writer() io.Writer {
+	ws := make([]io.Writer, 0, len(hs))
+	for _, h := range hs {
+		ws = append(ws, h)
+	}
+	return io.MultiWriter(ws...)
+}
+
+// Sum returns hex encoded digest or empty string if algorithm isn't computed.
+func (hs hashSet) Sum(name string) string {
+	h, ok := hs[name]
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (hs hashSet) FInfo(size int64) FInfo {
+	return FInfo{
+		Hash:   hs.Sum("sha1"),
+		SHA256: hs.Sum("sha256"),
+		Size:   size,
+	}
+}
+
+func validHex(hash string, size int) bool {
+	raw, err := hex.DecodeString(hash)
+	return err == nil && len(raw) == size
+}
+
+func (s *Store) fileInfo(path string, algos ...string) (info FInfo, err error) {
+	fd, err := s.st.Open(path)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+
+	hs := newHashSet(algos...)
+	size, err := io.Copy(hs.Writer(), fd)
+	if err != nil {
+		return
+	}
+	return hs.FInfo(size), nil
+}
+
+// algos lists hash algorithms for files matched against dl.
+func (s *Store) algos(dl Download) []string {
+	return append(dl.Algos(), s.hashes...)
+}
+
+func (s *Store) checkHash(path, hash string) error {
+	dhash, err := hex.DecodeString(hash)
+	if err != nil || len(dhash) != 20 {
+		return fmt.Errorf("invalid hash \"%s\" provided for \"%s\"", hash, filepath.Base(path))
+	}
+	fhash, err := s.fileHash(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(dhash, fhash) {
+		return nil
+	}
+	return fmt.Errorf("hash sums mismatched for \"%s\":\ndefined:\t %s \ncalicated:\t %s",
+		filepath.Base(path), hash, hex.EncodeToString(fhash))
+
+}
+
+func (s *Store) fileHash(path string) ([]byte, error) {
+	fd, err := s.st.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	h := sha1.New()
+	_, err = io.Copy(h, fd)
+	return h.Sum(nil), err
+}
@@ -0,0 +1,28 @@
+package store
+
+// LockedError is returned by Store.Lock if lock is held by another process.
+type LockedError struct {
+	Holder string
+}
+
+func (e *LockedError) Error() string {
+	return "store is locked by " + e.Holder
+}
+
+// Lock takes store lock, so concurrent runs don't modify the store at the same time:
+// exclusive one for mutating work, shared one for reading. If wait is set,
+// it waits until lock is released, otherwise LockedError is returned.
+// Lock is a no-op if storage doesn't implement Locker.
+func (s *Store) Lock(exclusive, wait bool) (unlock func(), err error) {
+	l, ok := s.st.(Locker)
+	if !ok {
+		return func() {}, nil
+	}
+
+	unlock, err = l.Lock(exclusive, false)
+	if le, ok := err.(*LockedError); ok && wait {
+		s.log.Printf("Waiting for %s...", le.Holder)
+		unlock, err = l.Lock(exclusive, true)
+	}
+	return unlock, err
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// Level of log messages, messages above logger level are dropped.
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var levelNames = [...]string{"error", "warn", "info", "debug"}
+
+func (l Level) String() string {
+	if l < LevelError || l > LevelDebug {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses level name as printed by Level.String.
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(l), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level \"%s\"", name)
+}
+
+// Logger writes leveled messages. Error, warning and debug messages are tagged,
+// Print methods write info messages, so Logger may replace log.Logger.
+type Logger struct {
+	out   *log.Logger
+	level Level
+}
+
+// NewLogger creates logger writing messages up to level to out, flags are as in log package.
+func NewLogger(out io.Writer, flags int, level Level) *Logger {
+	return &Logger{out: log.New(out, "", flags), level: level}
+}
+
+// discardLogger drops everything.
+func discardLogger() *Logger {
+	return NewLogger(ioutil.Discard, 0, LevelError)
+}
+
+// Enabled reports whether messages of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level <= l.level
+}
+
+func (l *Logger) Level() Level {
+	return l.level
+}
+
+// Writer returns output of the logger.
+func (l *Logger) Writer() io.Writer {
+	return l.out.Writer()
+}
+
+// withOutput returns logger with the same level and flags writing to w.
+func (l *Logger) withOutput(w io.Writer) *Logger {
+	return &Logger{out: log.New(w, l.out.Prefix(), l.out.Flags()), level: l.level}
+}
+
+func (l *Logger) output(level Level, msg string) {
+	if !l.Enabled(level) {
+		return
+	}
+	// log adds line break itself, leading blank lines separate blocks in plain output only
+	msg = strings.TrimRight(msg, "\n")
+	if l.out.Flags() != 0 {
+		msg = strings.TrimLeft(msg, "\n")
+		if msg == "" {
+			return
+		}
+	}
+	if level != LevelInfo {
+		msg = level.String() + ": " + msg
+	}
+	_ = l.out.Output(3, msg)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.output(LevelError, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.output(LevelWarn, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.output(LevelDebug, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Print(v ...interface{}) {
+	l.output(LevelInfo, fmt.Sprint(v...))
+}
+
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintf(format, v...))
+}
+
+func (l *Logger) Println(v ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintln(v...))
+}
@@ -0,0 +1,309 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Remove deletes client directory and regenerates versions.json of its prefix,
+// prefixes.json and references.json. Other clients aren't checked,
+// use Cleanup to delete objects, that aren't required anymore.
+func (s *Store) Remove(prefix, version string) error {
+	versionRoot := prefix + "/" + version + "/"
+	if _, err := s.st.Stat(versionRoot + version + ".json"); err != nil {
+		return fmt.Errorf("client \"%s/%s\" not found: %v", prefix, version, err)
+	}
+
+	// e.g. client pinned as latest can't be removed, nothing is deleted then
+	list, err := s.nextVersions(prefix, version, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = removeTree(s.st, versionRoot); err != nil {
+		return fmt.Errorf("failed to remove \"%s/%s\": %v", prefix, version, err)
+	}
+	s.log.Printf("Client \"%s/%s\" removed", prefix, version)
+
+	if err = s.publishVersions(prefix+"/", list); err != nil {
+		return err
+	}
+	return s.updateLists()
+}
+
+// Copy copies client to other prefix or version id, rewriting id in <version>.json.
+// Source client is moved if move is set: its directory is renamed if backend
+// implements Renamer, otherwise it is copied and removed.
+// Lists are regenerated like in Remove, the copy is published only if the source is.
+func (s *Store) Copy(fromPrefix, fromVersion, toPrefix, toVersion string, move bool) error {
+	if IsSpecialDir(toPrefix) || strings.HasPrefix(toPrefix, ".") {
+		return fmt.Errorf("prefix \"%s\" belongs to special directories", toPrefix)
+	}
+	if toVersion == "versions" {
+		return fmt.Errorf("\"versions\" can't be used as client id")
+	}
+
+	fromRoot := fromPrefix + "/" + fromVersion + "/"
+	toRoot := toPrefix + "/" + toVersion + "/"
+	var info VInfoFull
+	if err := readJSON(s.st, fromRoot+fromVersion+".json", &info); err != nil {
+		return fmt.Errorf("client \"%s/%s\" not found: %v", fromPrefix, fromVersion, err)
+	}
+	if _, err := s.st.Stat(toRoot); !os.IsNotExist(err) {
+		return fmt.Errorf("\"%s/%s\" already exists", toPrefix, toVersion)
+	}
+
+	// copy is published only if the source is, clients skipped by collect stay so
+	published, err := s.isPublished(fromPrefix, fromVersion)
+	if err != nil {
+		return err
+	}
+	var added *VInfoMin
+	if published {
+		added = &VInfoMin{}
+		*added = info.VInfoMin
+		added.Id = toVersion
+	}
+
+	// both lists are validated before anything is changed
+	removed := ""
+	if move && fromPrefix == toPrefix {
+		removed = fromVersion
+	}
+	toList, err := s.nextVersions(toPrefix, removed, added)
+	if err != nil {
+		return err
+	}
+	var fromList, fromOld *Prefix
+	if move && fromPrefix != toPrefix {
+		if fromList, err = s.nextVersions(fromPrefix, fromVersion, nil); err != nil {
+			return err
+		}
+		if fromOld, err = s.nextVersions(fromPrefix, "", nil); err != nil {
+			return err
+		}
+		// source prefix stops referring to the client before it is gone
+		if err = s.publishVersions(fromPrefix+"/", fromList); err != nil {
+			return err
+		}
+	}
+
+	// published lists don't refer to the new client until everything is copied
+	if r, ok := s.st.(Renamer); move && ok {
+		err = s.renameClient(r, fromPrefix, fromVersion, toPrefix, toVersion)
+	} else {
+		err = s.copyClient(fromPrefix, fromVersion, toPrefix, toVersion, move)
+	}
+	if err != nil {
+		if fromOld != nil {
+			if perr := s.publishVersions(fromPrefix+"/", fromOld); perr != nil {
+				s.warnf("Failed to restore versions.json of prefix \"%s\": %v", fromPrefix, perr)
+			}
+		}
+		return err
+	}
+
+	if err = s.publishVersions(toPrefix+"/", toList); err != nil {
+		return err
+	}
+	return s.updateLists()
+}
+
+// isPublished reports whether client is listed in published versions.json of prefix.
+func (s *Store) isPublished(prefix, version string) (bool, error) {
+	list := NewPrefix()
+	err := readJSON(s.st, prefix+"/versions/versions.json", list)
+	switch {
+	case os.IsNotExist(err):
+		return false, nil
+
+	case err != nil:
+		return false, fmt.Errorf("failed to read versions.json: %v", err)
+	}
+	for _, v := range list.Versions {
+		if v.Id == version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// copyClient copies client files to the new location, removing the source if move is set.
+func (s *Store) copyClient(fromPrefix, fromVersion, toPrefix, toVersion string, move bool) error {
+	fromRoot := fromPrefix + "/" + fromVersion + "/"
+	toRoot := toPrefix + "/" + toVersion + "/"
+	err := s.st.Walk(fromRoot, func(fi FileInfo) error {
+		rel := strings.TrimPrefix(fi.Path, fromRoot)
+		switch rel {
+		case fromVersion + ".json":
+			return s.rewriteVersionJSON(fi.Path, toRoot+toVersion+".json",
+				map[string]interface{}{"id": toVersion})
+
+		case fromVersion + ".jar":
+			rel = toVersion + ".jar"
+
+		case fingerprintFile:
+			// json is changed, so fingerprint is outdated anyway
+			return nil
+		}
+		return copyFile(s.st, fi.Path, toRoot+rel)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy \"%s/%s\": %v", fromPrefix, fromVersion, err)
+	}
+	s.log.Printf("Client \"%s/%s\" copied to \"%s/%s\"", fromPrefix, fromVersion, toPrefix, toVersion)
+
+	if !move {
+		return nil
+	}
+	if err = removeTree(s.st, fromRoot); err != nil {
+		return fmt.Errorf("failed to remove \"%s/%s\": %v", fromPrefix, fromVersion, err)
+	}
+	s.log.Printf("Client \"%s/%s\" removed", fromPrefix, fromVersion)
+	return nil
+}
+
+// renameClient moves client directory at once and renames its files to the new id.
+func (s *Store) renameClient(r Renamer, fromPrefix, fromVersion, toPrefix, toVersion string) error {
+	toRoot := toPrefix + "/" + toVersion + "/"
+	err := r.Rename(fromPrefix+"/"+fromVersion, toPrefix+"/"+toVersion)
+	if err != nil {
+		return fmt.Errorf("failed to move \"%s/%s\": %v", fromPrefix, fromVersion, err)
+	}
+
+	if err = s.rewriteVersionJSON(toRoot+fromVersion+".json", toRoot+toVersion+".json",
+		map[string]interface{}{"id": toVersion}); err != nil {
+		return err
+	}
+	if fromVersion != toVersion {
+		if err = s.st.Remove(toRoot + fromVersion + ".json"); err != nil {
+			return err
+		}
+		err = r.Rename(toRoot+fromVersion+".jar", toRoot+toVersion+".jar")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// json is changed, so fingerprint is outdated anyway
+	if err = s.st.Remove(toRoot + fingerprintFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	s.log.Printf("Client \"%s/%s\" moved to \"%s/%s\"", fromPrefix, fromVersion, toPrefix, toVersion)
+	return nil
+}
+
+// rewriteVersionJSON copies <version>.json replacing passed fields,
+// nil value deletes field, other fields are kept as is.
+func (s *Store) rewriteVersionJSON(from, to string, set map[string]interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := readJSON(s.st, from, &fields); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", from, err)
+	}
+	for k, v := range set {
+		if v == nil {
+			delete(fields, k)
+			continue
+		}
+		fields[k], _ = json.Marshal(v)
+	}
+	data, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.st, to, data)
+}
+
+// updateVersions regenerates versions.json of prefix without checking clients.
+func (s *Store) updateVersions(prefix string) error {
+	list, err := s.nextVersions(prefix, "", nil)
+	if err != nil {
+		return err
+	}
+	return s.publishVersions(prefix+"/", list)
+}
+
+// nextVersions makes new versions.json of prefix from the published one without checking clients:
+// removed client is dropped, added one is appended. Nothing is written,
+// so list is validated before clients are changed.
+func (s *Store) nextVersions(prefix, removed string, added *VInfoMin) (*Prefix, error) {
+	prefixRoot := prefix + "/"
+	s.readPrefixInfo(prefixRoot)
+
+	list := NewPrefix()
+	err := readJSON(s.st, prefixRoot+"versions/versions.json", list)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read versions.json: %v", err)
+	}
+
+	versions := list.Versions[:0]
+	for _, v := range list.Versions {
+		if v.Id != removed && (added == nil || v.Id != added.Id) {
+			versions = append(versions, v)
+		}
+	}
+	if added != nil {
+		versions = append(versions, added)
+	}
+	return s.makePrefix(prefix, versions)
+}
+
+// updateLists regenerates prefixes.json and references.json from existing versions.json files.
+func (s *Store) updateLists() error {
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return fmt.Errorf("can't read store root directory: %v", err)
+	}
+
+	plist := NewPrefixList()
+	var names []string
+	for _, fi := range dir {
+		if _, err := s.st.Stat(fi.Name() + "/versions/versions.json"); err != nil {
+			continue
+		}
+		names = append(names, fi.Name())
+		pInfo := s.readPrefixInfo(fi.Name() + "/")
+		if pInfo.Listed() {
+			plist.Prefixes[fi.Name()] = pInfo.PrefixInfo
+		}
+	}
+
+	err = writeFile(s.st, "prefixes.json", s.marshalOutput(plist))
+	if err != nil {
+		return fmt.Errorf("failed to write prefixes.json: %v", err)
+	}
+
+	err = s.buildRefs(names)
+	if err != nil {
+		return fmt.Errorf("failed to build %s: %v", refsFile, err)
+	}
+	return nil
+}
+
+// removeTree removes all files under dir.
+func removeTree(st Storage, dir string) error {
+	return st.Walk(dir, func(fi FileInfo) error {
+		return st.Remove(fi.Path)
+	})
+}
+
+// copyFile copies file within storage.
+func copyFile(st Storage, from, to string) error {
+	rc, err := st.Open(from)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	wr, err := st.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(wr, rc); err != nil {
+		_ = wr.Abort()
+		return err
+	}
+	return wr.Commit()
+}
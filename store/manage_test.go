@@ -0,0 +1,43 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCopyUnpublished(t *testing.T) {
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{
+		"default/pub/pub.json":           `{"id":"pub","type":"release"}`,
+		"default/pub/data.json":          `{"main":{"hash":"` + sha1Hex("") + `","size":0}}`,
+		"default/skipped/skipped.json":   `{"id":"skipped","type":"release"}`,
+		"default/versions/versions.json": `{"latest":{"release":"pub"},"versions":[{"id":"pub","type":"release"}]}`,
+		"other/versions/versions.json":   `{"latest":{},"versions":[]}`,
+	} {
+		if err = writeFile(st, path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.Copy("default", "skipped", "other", "copy", false); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Copy("default", "pub", "other", "pub2", true); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := readFile(st, "other/versions/versions.json")
+	if strings.Contains(string(list), `"copy"`) {
+		t.Errorf("copy of unpublished client is published:\n%s", list)
+	}
+	if !strings.Contains(string(list), `"pub2"`) {
+		t.Errorf("copy of published client isn't published:\n%s", list)
+	}
+	if list, _ = readFile(st, "default/versions/versions.json"); strings.Contains(string(list), `"pub"`) {
+		t.Errorf("moved client is still published in source prefix:\n%s", list)
+	}
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errMissing is returned instead of downloading in offline mode,
+// the file is recorded to the fetch list.
+var errMissing = errors.New("file is missing, not downloaded in offline mode")
+
+// FetchItem describes file, that should be downloaded to the store.
+type FetchItem struct {
+	// Path relative to store root.
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	SHA1 string `json:"sha1,omitempty"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// FetchList is a list of files missing in offline mode.
+type FetchList struct {
+	Files []FetchItem `json:"files"`
+}
+
+func (fl *FetchList) Marshal() []byte {
+	data, _ := json.MarshalIndent(fl, "", "  ")
+	return data
+}
+
+type missingSet struct {
+	mu    sync.Mutex
+	items map[string]FetchItem
+}
+
+func (m *missingSet) add(item FetchItem) {
+	m.mu.Lock()
+	if m.items == nil {
+		m.items = make(map[string]FetchItem)
+	}
+	m.items[item.Path] = item
+	m.mu.Unlock()
+}
+
+// Missing returns files, that were required but not downloaded in offline mode.
+func (s *Store) Missing() *FetchList {
+	s.missing.mu.Lock()
+	defer s.missing.mu.Unlock()
+
+	fl := &FetchList{Files: make([]FetchItem, 0, len(s.missing.items))}
+	for _, item := range s.missing.items {
+		fl.Files = append(fl.Files, item)
+	}
+	sort.Slice(fl.Files, func(i, j int) bool { return fl.Files[i].Path < fl.Files[j].Path })
+	return fl
+}
+
+// offlineFile is getFile replacement for offline mode.
+// File already present in the store is used if it matches expectations,
+// otherwise it is recorded as missing for fetch list.
+func (w *worker) offlineFile(dl *Download, destPath string) error {
+	if err := w.presentFile(dl, destPath); err != errMissing {
+		return err
+	}
+	w.missing.add(FetchItem{
+		Path: destPath,
+		URL:  dl.URL,
+		SHA1: strings.ToLower(dl.SHA1),
+		Size: dl.Size,
+	})
+	w.log.Printf("Missing file \"%s\"", filepath.Base(destPath))
+	return errMissing
+}
+
+// presentFile is getFile replacement for read-only mode, see Audit.
+// File already present in the store is used if it matches expectations,
+// otherwise it is recorded only in worker missed list.
+func (w *worker) presentFile(dl *Download, destPath string) error {
+	info, err := w.fileInfo(destPath, w.algos(*dl)...)
+	switch {
+	case err == nil && dl.Match(info):
+		dl.Size = info.Size
+		dl.SHA1 = info.Hash
+		dl.SHA256 = info.SHA256
+		return nil
+
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+
+	w.missed = append(w.missed, destPath)
+	return errMissing
+}
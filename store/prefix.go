@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// prefixTypes lists known prefix types:
+// public prefixes are listed in prefixes.json, hidden are not,
+// private are not listed and served only with access token, see Handler.
+var prefixTypes = []string{"public", "hidden", "private"}
+
+// IsPrefixType reports whether t is known prefix type.
+func IsPrefixType(t string) bool {
+	return inSlice(t, prefixTypes)
+}
+
+// Listed reports whether prefix is listed in prefixes.json.
+func (p PrefixInfo) Listed() bool {
+	return p.Type != "hidden" && p.Type != "private"
+}
+
+// PrefixSummary describes prefix with its clients as they are on disk.
+type PrefixSummary struct {
+	Name string `json:"name"`
+	PrefixInfoExt
+	// clients and effective latest versions
+	Clients *Prefix `json:"clients"`
+}
+
+// PrefixInfo reads prefix.json, defaults are returned if it is missing.
+func (s *Store) PrefixInfo(name string) (*PrefixInfoExt, error) {
+	pInfo := &PrefixInfoExt{PrefixInfo: PrefixInfo{Type: "public"}}
+	err := readJSON(s.st, name+"/prefix.json", pInfo)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse prefix.json: %v", err)
+	}
+	return pInfo, nil
+}
+
+// WritePrefixInfo validates and writes prefix.json.
+// Prefix is created unless it already exists, existing prefix.json is required
+// to be present if create isn't set. Published lists are regenerated.
+func (s *Store) WritePrefixInfo(name string, pInfo *PrefixInfoExt, create bool) error {
+	if IsSpecialDir(name) || len(name) == 0 || name[0] == '.' {
+		return fmt.Errorf("prefix \"%s\" belongs to special directories", name)
+	}
+
+	_, err := s.st.Stat(name + "/prefix.json")
+	switch {
+	case create && err == nil:
+		return fmt.Errorf("prefix \"%s\" already exists", name)
+
+	case !create && os.IsNotExist(err):
+		if _, err := s.st.Stat(name + "/"); err != nil {
+			return fmt.Errorf("prefix \"%s\" not found", name)
+		}
+
+	case err != nil && !os.IsNotExist(err):
+		return err
+	}
+
+	if err = s.validatePrefixInfo(name, pInfo); err != nil {
+		return err
+	}
+
+	data, _ := json.MarshalIndent(pInfo, "", "  ")
+	if err = writeFile(s.st, name+"/prefix.json", data); err != nil {
+		return fmt.Errorf("failed to write prefix.json: %v", err)
+	}
+	s.log.Printf("Prefix \"%s\" saved", name)
+
+	// latest overrides may be changed
+	if _, err = s.st.Stat(name + "/versions/versions.json"); err == nil {
+		if err = s.updateVersions(name); err != nil {
+			return err
+		}
+	}
+	return s.updateLists()
+}
+
+func (s *Store) validatePrefixInfo(name string, pInfo *PrefixInfoExt) error {
+	if !inSlice(pInfo.Type, prefixTypes) {
+		return fmt.Errorf("unknown prefix type \"%s\", expected one of %v", pInfo.Type, prefixTypes)
+	}
+	for t, version := range pInfo.Latest {
+		var info VInfoMin
+		err := readJSON(s.st, name+"/"+version+"/"+version+".json", &info)
+		if err != nil {
+			return fmt.Errorf("latest %s \"%s\" isn't valid client: %v", t, version, err)
+		}
+		if info.Type != t {
+			return fmt.Errorf("latest %s \"%s\" has type \"%s\"", t, version, info.Type)
+		}
+	}
+	return nil
+}
+
+// ListPrefixes reads prefix.json and <version>.json of all clients in all prefixes
+// without checking them.
+func (s *Store) ListPrefixes() ([]*PrefixSummary, error) {
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return nil, fmt.Errorf("can't read store root directory: %v", err)
+	}
+
+	list := make([]*PrefixSummary, 0, len(dir))
+	for _, fi := range dir {
+		pInfo := s.readPrefixInfo(fi.Name() + "/")
+		sum := &PrefixSummary{Name: fi.Name(), PrefixInfoExt: *pInfo}
+
+		vdir, err := s.st.ReadDir(fi.Name() + "/")
+		if err != nil {
+			return nil, fmt.Errorf("can't read prefix root directory: %v", err)
+		}
+		var versions []*VInfoMin
+		for _, vi := range vdir {
+			if !vi.IsDir || vi.Name() == "versions" {
+				continue
+			}
+			var info VInfoMin
+			err = readJSON(s.st, fi.Name()+"/"+vi.Name()+"/"+vi.Name()+".json", &info)
+			if err != nil {
+				s.warnf("Client \"%s/%s\" skipped: %v", fi.Name(), vi.Name(), err)
+				continue
+			}
+			versions = append(versions, &info)
+		}
+
+		sum.Clients, err = s.makePrefix(fi.Name(), versions)
+		if err != nil {
+			return nil, fmt.Errorf("prefix \"%s\": %v", fi.Name(), err)
+		}
+		list = append(list, sum)
+	}
+	return list, nil
+}
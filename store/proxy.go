@@ -0,0 +1,131 @@
+package store
+
+import (
+	"crypto/sha1"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyRetryAfter is Retry-After in seconds for requests, that can't be proxied while store is locked.
+const proxyRetryAfter = 30
+
+// errNotShared is returned by fetchShared for paths, that can't be fetched from upstream.
+var errNotShared = errors.New("not a library or asset object")
+
+// proxyRefs caches references.json for proxy, so it isn't parsed on every request.
+type proxyRefs struct {
+	mu      sync.Mutex
+	refs    *RefIndex
+	modTime time.Time
+}
+
+// get returns the current references, empty ones if references.json is missing.
+func (pr *proxyRefs) get(s *Store) *RefIndex {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	fi, err := s.st.Stat(refsFile)
+	if err != nil {
+		pr.refs = nil
+		return NewRefIndex()
+	}
+	if pr.refs == nil || !fi.ModTime.Equal(pr.modTime) {
+		refs := NewRefIndex()
+		if err = readJSON(s.st, refsFile, refs); err != nil {
+			s.warnf("Failed to read %s: %v", refsFile, err)
+			return NewRefIndex()
+		}
+		pr.refs, pr.modTime = refs, fi.ModTime
+	}
+	return pr.refs
+}
+
+// shared reports whether missing file may be fetched from upstream:
+// assets objects and libraries used by published clients according to references.json
+// and, if it is enabled, libraries laid out like maven artifacts.
+func (srv *server) shared(p string) bool {
+	switch {
+	case strings.HasPrefix(p, "assets/objects/"):
+		hash := p[strings.LastIndex(p, "/")+1:]
+		if !validHex(hash, sha1.Size) || p != "assets/objects/"+hash[:2]+"/"+hash {
+			return false
+		}
+		_, ok := srv.refs.get(srv.Store).Assets[hash]
+		return ok
+
+	case strings.HasPrefix(p, "libraries/") && !strings.HasSuffix(p, "/"+overwriteFile):
+		path := strings.TrimSuffix(strings.TrimPrefix(p, "libraries/"), ".sha1")
+		if srv.maven && mavenPath(path) {
+			return true
+		}
+		_, ok := srv.refs.get(srv.Store).Libs[path]
+		return ok
+	}
+	return false
+}
+
+// mavenPath reports whether library path looks like maven artifact:
+// <group>/<artifact>/<version>/<artifact>-<version>[-<classifier>].jar
+func mavenPath(path string) bool {
+	parts := strings.Split(path, "/")
+	if len(parts) < 4 {
+		return false
+	}
+	artifact, version, file := parts[len(parts)-3], parts[len(parts)-2], parts[len(parts)-1]
+	return strings.HasPrefix(file, artifact+"-"+version) && strings.HasSuffix(file, ".jar")
+}
+
+// fetchShared downloads missing library or asset object from upstream.
+// Concurrent requests for the same object wait for the first one
+// and don't download it again. Shared store lock is held while fetch,
+// so cleanup doesn't remove fetched file meanwhile. LockedError is returned
+// instead of waiting, if the store is locked exclusively.
+func (s *Store) fetchShared(p string) error {
+	w := s.newWorker()
+
+	switch {
+	case strings.HasPrefix(p, "assets/objects/"):
+		hash := p[strings.LastIndex(p, "/")+1:]
+		if !validHex(hash, sha1.Size) || p != "assets/objects/"+hash[:2]+"/"+hash {
+			return errNotShared
+		}
+		unlock, err := s.Lock(false, false)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		defer s.checked.Lock("asset:" + hash)()
+		if _, err := s.st.Stat(p); !os.IsNotExist(err) {
+			return err
+		}
+		return w.getFile(&Download{
+			SHA1: hash,
+			URL:  s.upstream.Assets + hash[:2] + "/" + hash,
+		}, p)
+
+	case strings.HasPrefix(p, "libraries/") && !strings.HasSuffix(p, "/"+overwriteFile):
+		unlock, err := s.Lock(false, false)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		// jar is verified by upstream .sha1, that is stored as well
+		path := strings.TrimSuffix(strings.TrimPrefix(p, "libraries/"), ".sha1")
+		defer s.checked.Lock("lib:" + path)()
+		if _, err := s.st.Stat(p); !os.IsNotExist(err) {
+			return err
+		}
+		_, err = w.getLibOld(path, s.upstream.Libraries)
+		return err
+	}
+	return errNotShared
+}
+
+// upstreamNotFound reports whether fetch failed since upstream doesn't have the file.
+func upstreamNotFound(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && se.code == 404
+}
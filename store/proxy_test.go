@@ -0,0 +1,185 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// proxyUpstream serves files and counts requests by path.
+type proxyUpstream struct {
+	files map[string]string
+	// called before every response, if set
+	before func(path string)
+
+	mu        sync.Mutex
+	requested map[string]int
+}
+
+func (u *proxyUpstream) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	u.mu.Lock()
+	u.requested[req.URL.Path]++
+	u.mu.Unlock()
+
+	if u.before != nil {
+		u.before(req.URL.Path)
+	}
+	data, ok := u.files[req.URL.Path]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	_, _ = w.Write([]byte(data))
+}
+
+// newProxyStore makes store with upstream at srv and references.json listing refs.
+func newProxyStore(t *testing.T, st Storage, srv *httptest.Server, refs *RefIndex) *Store {
+	t.Helper()
+	s, err := New(Options{Storage: st, Upstream: Upstream{
+		Libraries: srv.URL + "/libraries/",
+		Assets:    srv.URL + "/assets/",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(refs)
+	if err = writeFile(st, refsFile, data); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func assetPath(data string) string {
+	return sha1Hex(data)[:2] + "/" + sha1Hex(data)
+}
+
+func proxyGet(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Error(err)
+		return 0, ""
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestProxy(t *testing.T) {
+	asset, unlisted := "asset", "unlisted"
+	up := &proxyUpstream{requested: make(map[string]int), files: map[string]string{
+		"/libraries/a/b/1/b-1.jar":         "lib",
+		"/libraries/a/b/1/b-1.jar.sha1":    sha1Hex("lib"),
+		"/libraries/odd/x.jar":             "odd",
+		"/libraries/odd/x.jar.sha1":        sha1Hex("odd"),
+		"/libraries/other/y.jar":           "y",
+		"/libraries/other/y.jar.sha1":      sha1Hex("y"),
+		"/libraries/listed/1/listed-1.jar": "listed",
+		"/assets/" + assetPath(asset):      asset,
+		"/assets/" + assetPath(unlisted):   unlisted,
+	}}
+	upstream := httptest.NewServer(up)
+	defer upstream.Close()
+
+	refs := NewRefIndex()
+	refs.Libs["odd/x.jar"] = []string{"default/1"}
+	refs.Libs["missing/1/missing-1.jar"] = []string{"default/1"}
+	refs.Assets[sha1Hex(asset)] = []string{"1"}
+
+	for _, maven := range []bool{false, true} {
+		st := NewMemStorage()
+		srv := httptest.NewServer(newProxyStore(t, st, upstream, refs).ProxyHandler(maven))
+
+		mavenStatus := http.StatusNotFound
+		if maven {
+			mavenStatus = http.StatusOK
+		}
+		for _, tc := range []struct {
+			path   string
+			status int
+			body   string
+		}{
+			// maven layout
+			{"/libraries/a/b/1/b-1.jar", mavenStatus, "lib"},
+			// listed in references
+			{"/libraries/odd/x.jar", http.StatusOK, "odd"},
+			{"/assets/objects/" + assetPath(asset), http.StatusOK, asset},
+			// upstream 404
+			{"/libraries/missing/1/missing-1.jar", http.StatusNotFound, ""},
+			// neither listed nor maven layout, upstream isn't asked
+			{"/libraries/other/y.jar", http.StatusNotFound, ""},
+			{"/assets/objects/" + assetPath(unlisted), http.StatusNotFound, ""},
+		} {
+			status, body := proxyGet(t, srv.URL+tc.path)
+			if status != tc.status || tc.status == http.StatusOK && body != tc.body {
+				t.Errorf("maven %v: GET %s: got %d \"%s\", want %d \"%s\"", maven, tc.path, status, body, tc.status, tc.body)
+			}
+		}
+		srv.Close()
+
+		if maven {
+			checkContent(t, st, "libraries/a/b/1/b-1.jar", "lib")
+		} else if _, ok := st.files["libraries/a/b/1/b-1.jar"]; ok {
+			t.Error("library isn't listed in references, but fetched without maven fallback")
+		}
+	}
+
+	for path, n := range up.requested {
+		if strings.Contains(path, "other") || strings.Contains(path, sha1Hex(unlisted)) {
+			t.Errorf("unreferenced %s is requested from upstream %d times", path, n)
+		}
+	}
+}
+
+func TestProxyCoalesce(t *testing.T) {
+	const n = 10
+	asset := "asset"
+	var s *Store
+	up := &proxyUpstream{requested: make(map[string]int), files: map[string]string{
+		"/assets/" + assetPath(asset): asset,
+	}}
+	// response is held until all requests wait for the same object
+	up.before = func(string) {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			s.checked.mu.Lock()
+			l := s.checked.locks["asset:"+sha1Hex(asset)]
+			waiting := l != nil && l.refs == n
+			s.checked.mu.Unlock()
+			if waiting {
+				return
+			}
+		}
+		t.Error("requests aren't waiting for the same object")
+	}
+	upstream := httptest.NewServer(up)
+	defer upstream.Close()
+
+	refs := NewRefIndex()
+	refs.Assets[sha1Hex(asset)] = []string{"1"}
+	s = newProxyStore(t, NewMemStorage(), upstream, refs)
+	srv := httptest.NewServer(s.ProxyHandler(false))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status, body := proxyGet(t, srv.URL+"/assets/objects/"+assetPath(asset)); status != http.StatusOK || body != asset {
+				t.Errorf("got %d \"%s\"", status, body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := up.requested["/assets/"+assetPath(asset)]; got != 1 {
+		t.Errorf("object is requested from upstream %d times, want 1", got)
+	}
+	if len(s.checked.locks) != 0 {
+		t.Errorf("%d fetch locks are left", len(s.checked.locks))
+	}
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const refsFile = "references.json"
+
+// RefIndex maps store objects to clients using them.
+// Built by collect and saved to references.json in the store root.
+type RefIndex struct {
+	// library path -> "<prefix>/<version>"
+	Libs map[string][]string `json:"libs"`
+	// assets index key -> "<prefix>/<version>"
+	Indexes map[string][]string `json:"indexes"`
+	// asset hash -> assets index keys
+	Assets map[string][]string `json:"assets"`
+	// sha1 of client jar or custom file -> "<prefix>/<version>/<path>"
+	Files map[string][]string `json:"files"`
+}
+
+func NewRefIndex() *RefIndex {
+	return &RefIndex{
+		Libs:    make(map[string][]string),
+		Indexes: make(map[string][]string),
+		Assets:  make(map[string][]string),
+		Files:   make(map[string][]string),
+	}
+}
+
+// Reference describes how client uses object.
+type Reference struct {
+	Client string
+	// store path or description of the intermediate object
+	Via string
+}
+
+// publishedClient is client listed in versions.json with its published data.
+type publishedClient struct {
+	Prefix, Version string
+	Files           *FilesInfo
+	// assets index key, path and content, empty if client has no assets
+	IndexKey, IndexPath string
+	Index               *ObjectList
+}
+
+func (c *publishedClient) Name() string {
+	return c.Prefix + "/" + c.Version
+}
+
+// publishedClients reads versions.json of passed prefixes,
+// data.json and assets indexes of listed clients.
+func (s *Store) publishedClients(prefixes []string) ([]*publishedClient, error) {
+	var clients []*publishedClient
+	indexes := make(map[string]*ObjectList)
+
+	for _, prefix := range prefixes {
+		list := NewPrefix()
+		if err := readJSON(s.st, prefix+"/versions/versions.json", list); err != nil {
+			return nil, fmt.Errorf("failed to read versions.json of \"%s\": %v", prefix, err)
+		}
+
+		for _, v := range list.Versions {
+			c := &publishedClient{Prefix: prefix, Version: v.Id, Files: NewFilesInfo()}
+			versionRoot := c.Name() + "/"
+
+			if err := readJSON(s.st, versionRoot+"data.json", c.Files); err != nil {
+				return nil, fmt.Errorf("failed to read data.json of \"%s\": %v", c.Name(), err)
+			}
+
+			var info VInfoFull
+			if err := readJSON(s.st, versionRoot+v.Id+".json", &info); err != nil {
+				return nil, fmt.Errorf("failed to read %s.json: %v", v.Id, err)
+			}
+			if len(info.Assets) != 0 {
+				key, path := s.assetIndexPath(info.Assets, &info.AssetIndex)
+				index, ok := indexes[key]
+				if !ok {
+					var err error
+					index, err = s.parseIndex(path)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse assets index \"%s\": %v", key, err)
+					}
+					indexes[key] = index
+				}
+				c.IndexKey, c.IndexPath, c.Index = key, path, index
+			}
+
+			clients = append(clients, c)
+		}
+	}
+	return clients, nil
+}
+
+// buildRefs writes references.json for published clients of passed prefixes.
+func (s *Store) buildRefs(prefixes []string) error {
+	clients, err := s.publishedClients(prefixes)
+	if err != nil {
+		return err
+	}
+
+	refs := NewRefIndex()
+	for _, c := range clients {
+		versionRoot := c.Name() + "/"
+		main := c.Files.Main.Hash
+		refs.Files[main] = append(refs.Files[main], versionRoot+c.Version+".jar")
+		for path := range c.Files.Libs {
+			refs.Libs[path] = append(refs.Libs[path], c.Name())
+		}
+		if c.Files.Files != nil {
+			for path, info := range c.Files.Files.Index {
+				refs.Files[info.Hash] = append(refs.Files[info.Hash], versionRoot+"files/"+path)
+			}
+		}
+
+		if c.Index == nil {
+			continue
+		}
+		if _, ok := refs.Indexes[c.IndexKey]; !ok {
+			seen := make(map[string]bool, len(c.Index.Data))
+			for _, a := range c.Index.Data {
+				if !seen[a.Hash] {
+					seen[a.Hash] = true
+					refs.Assets[a.Hash] = append(refs.Assets[a.Hash], c.IndexKey)
+				}
+			}
+		}
+		refs.Indexes[c.IndexKey] = append(refs.Indexes[c.IndexKey], c.Name())
+	}
+
+	for _, m := range []map[string][]string{refs.Libs, refs.Indexes, refs.Assets, refs.Files} {
+		for _, list := range m {
+			sort.Strings(list)
+		}
+	}
+
+	data, _ := json.MarshalIndent(refs, "", "  ")
+	return writeFile(s.st, refsFile, data)
+}
+
+// Why lists clients, that use library (path relative to libraries/),
+// asset or file with passed sha1. Uses references.json written by the last collect.
+func (s *Store) Why(object string) ([]Reference, error) {
+	refs := NewRefIndex()
+	err := readJSON(s.st, refsFile, refs)
+	switch {
+	case os.IsNotExist(err):
+		return nil, fmt.Errorf("%s not found, run collect first", refsFile)
+
+	case err != nil:
+		return nil, fmt.Errorf("failed to parse %s: %v", refsFile, err)
+	}
+
+	var list []Reference
+	if validHex(object, sha1.Size) {
+		hash := strings.ToLower(object)
+		for _, key := range refs.Assets[hash] {
+			for _, client := range refs.Indexes[key] {
+				list = append(list, Reference{client, "assets index " + key})
+			}
+		}
+		for _, path := range refs.Files[hash] {
+			i := strings.Index(path, "/")
+			i += strings.Index(path[i+1:], "/") + 1
+			list = append(list, Reference{path[:i], path[i+1:]})
+		}
+		return list, nil
+	}
+
+	path := strings.TrimPrefix(object, "libraries/")
+	for _, client := range refs.Libs[path] {
+		list = append(list, Reference{client, "libraries/" + path})
+	}
+	return list, nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type ScaffoldOptions struct {
+	// Base client.
+	FromPrefix, From string
+	// Client type, the base one if empty.
+	Type string
+	// Copy files/ and mutables.list of the base client.
+	Files bool
+	// Hard link jar instead of copying if storage supports it.
+	// Linked jar must be replaced, not overwritten in place.
+	Link bool
+}
+
+// Scaffold creates new custom client from existing one and checks it.
+// Jar is copied or linked. <version>.json gets new id,
+// fresh time and releaseTime, upstream downloads are dropped,
+// since jar is expected to be replaced by custom build.
+// New client isn't published until the next collect, it is removed if anything fails.
+func (s *Store) Scaffold(prefix, id string, opts ScaffoldOptions) (*VInfoFull, error) {
+	if IsSpecialDir(prefix) || strings.HasPrefix(prefix, ".") {
+		return nil, fmt.Errorf("prefix \"%s\" belongs to special directories", prefix)
+	}
+	if id == "versions" {
+		return nil, fmt.Errorf("\"versions\" can't be used as client id")
+	}
+
+	fromRoot := opts.FromPrefix + "/" + opts.From + "/"
+	versionRoot := prefix + "/" + id + "/"
+	if _, err := s.st.Stat(fromRoot + opts.From + ".json"); err != nil {
+		return nil, fmt.Errorf("base client \"%s/%s\" not found: %v", opts.FromPrefix, opts.From, err)
+	}
+	if _, err := s.st.Stat(versionRoot); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("\"%s/%s\" already exists", prefix, id)
+	}
+
+	info, err := s.scaffold(prefix, id, opts)
+	if err != nil {
+		// half-built client would be picked up by the next collect
+		if rerr := removeTree(s.st, versionRoot); rerr != nil {
+			s.warnf("Failed to remove \"%s/%s\": %v", prefix, id, rerr)
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *Store) scaffold(prefix, id string, opts ScaffoldOptions) (*VInfoFull, error) {
+	fromRoot := opts.FromPrefix + "/" + opts.From + "/"
+	versionRoot := prefix + "/" + id + "/"
+	now := time.Now().UTC().Truncate(time.Second)
+	set := map[string]interface{}{
+		"id":          id,
+		"time":        now,
+		"releaseTime": now,
+		"downloads":   nil,
+	}
+	if opts.Type != "" {
+		set["type"] = opts.Type
+	}
+	err := s.rewriteVersionJSON(fromRoot+opts.From+".json", versionRoot+id+".json", set)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, newJar := fromRoot+opts.From+".jar", versionRoot+id+".jar"
+	if l, ok := s.st.(Linker); !opts.Link || !ok || l.Link(jar, newJar) != nil {
+		if err = copyFile(s.st, jar, newJar); err != nil {
+			return nil, fmt.Errorf("failed to copy jar: %v", err)
+		}
+	}
+
+	if opts.Files {
+		err = s.st.Walk(fromRoot+"files/", func(fi FileInfo) error {
+			return copyFile(s.st, fi.Path, versionRoot+strings.TrimPrefix(fi.Path, fromRoot))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy files: %v", err)
+		}
+		err = copyFile(s.st, fromRoot+"mutables.list", versionRoot+"mutables.list")
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to copy mutables.list: %v", err)
+		}
+	}
+
+	s.log.Printf("Client \"%s/%s\" created from \"%s/%s\"", prefix, id, opts.FromPrefix, opts.From)
+	return s.Check(prefix, id)
+}
@@ -0,0 +1,25 @@
+package store
+
+import (
+	"os"
+	"testing"
+)
+
+func TestScaffoldFailed(t *testing.T) {
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// base client without jar
+	if err = writeFile(st, "default/base/base.json", []byte(`{"id":"base","type":"release"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Scaffold("default", "custom", ScaffoldOptions{FromPrefix: "default", From: "base"}); err == nil {
+		t.Fatal("client is created without base jar")
+	}
+	if _, err = st.Stat("default/custom/"); !os.IsNotExist(err) {
+		t.Errorf("half-built client is left: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Handler serves store files over HTTP.
+// Files of private prefixes require access token passed in
+// "Authorization: Bearer <token>" header or "token" query parameter,
+// shared libraries and assets stay public. Dot files and references.json are never served.
+func (s *Store) Handler() http.Handler {
+	return &server{Store: s}
+}
+
+// ProxyHandler works as Handler, but libraries and assets objects missing in the store
+// are fetched from upstream, verified, stored and then served.
+// Only objects listed in references.json are fetched, with maven set
+// libraries laid out like maven artifacts are fetched as well.
+func (s *Store) ProxyHandler(maven bool) http.Handler {
+	return &server{Store: s, proxy: true, maven: maven, refs: new(proxyRefs)}
+}
+
+type server struct {
+	*Store
+	proxy, maven bool
+	refs         *proxyRefs
+}
+
+func (srv *server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	p := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+	status := srv.serveFile(rw, req, p)
+	srv.log.Debugf("%s /%s %d", req.Method, p, status)
+}
+
+func (srv *server) serveFile(rw http.ResponseWriter, req *http.Request, p string) int {
+	s := srv.Store
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return httpError(rw, http.StatusMethodNotAllowed)
+	}
+	if p == "" || strings.HasPrefix(p, ".") || strings.Contains(p, "/.") {
+		return httpError(rw, http.StatusNotFound)
+	}
+	// references name clients of private prefixes
+	if p == refsFile {
+		return httpError(rw, http.StatusNotFound)
+	}
+
+	if i := strings.Index(p, "/"); i > 0 && !IsSpecialDir(p[:i]) {
+		status := s.authorize(req, p[:i])
+		if status != http.StatusOK {
+			if status == http.StatusUnauthorized {
+				rw.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			return httpError(rw, status)
+		}
+	}
+
+	fi, err := s.st.Stat(p)
+	if os.IsNotExist(err) && srv.proxy && srv.shared(p) {
+		if ferr := s.fetchShared(p); ferr == nil {
+			fi, err = s.st.Stat(p)
+		} else if upstreamNotFound(ferr) {
+			return httpError(rw, http.StatusNotFound)
+		} else if _, ok := ferr.(*LockedError); ok {
+			// store is changed by another process, request isn't held meanwhile
+			rw.Header().Set("Retry-After", strconv.Itoa(proxyRetryAfter))
+			return httpError(rw, http.StatusServiceUnavailable)
+		} else if ferr != errNotShared {
+			s.warnf("Fetching \"%s\" failed: %v", p, ferr)
+			return httpError(rw, http.StatusBadGateway)
+		}
+	}
+	switch {
+	case os.IsNotExist(err) || err == nil && fi.IsDir:
+		return httpError(rw, http.StatusNotFound)
+
+	case err != nil:
+		s.warnf("Serving \"%s\" failed: %v", p, err)
+		return httpError(rw, http.StatusInternalServerError)
+	}
+
+	rc, err := s.st.Open(p)
+	if err != nil {
+		s.warnf("Serving \"%s\" failed: %v", p, err)
+		return httpError(rw, http.StatusInternalServerError)
+	}
+	defer rc.Close()
+
+	ctype := mime.TypeByExtension(path.Ext(p))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	rw.Header().Set("Content-Type", ctype)
+	rw.Header().Set("Content-Length", strconv.FormatInt(fi.Size, 10))
+	if !fi.ModTime.IsZero() {
+		rw.Header().Set("Last-Modified", fi.ModTime.UTC().Format(http.TimeFormat))
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	if req.Method == http.MethodGet {
+		_, _ = io.Copy(rw, rc)
+	}
+	return http.StatusOK
+}
+
+// authorize checks access token for files of private prefix.
+func (s *Store) authorize(req *http.Request, prefix string) int {
+	pInfo, err := s.PrefixInfo(prefix)
+	if err != nil {
+		s.warnf("Prefix \"%s\": %v", prefix, err)
+		return http.StatusInternalServerError
+	}
+	if pInfo.Type != "private" {
+		return http.StatusOK
+	}
+
+	token := req.URL.Query().Get("token")
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	ok, err := s.checkToken(prefix, token)
+	switch {
+	case err != nil:
+		s.warnf("Prefix \"%s\": %v", prefix, err)
+		return http.StatusInternalServerError
+
+	case !ok:
+		return http.StatusUnauthorized
+	}
+	return http.StatusOK
+}
+
+func httpError(rw http.ResponseWriter, status int) int {
+	http.Error(rw, http.StatusText(status), status)
+	return status
+}
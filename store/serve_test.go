@@ -0,0 +1,93 @@
+package store
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServePrivate(t *testing.T) {
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"public", "secret"} {
+		pInfo := &PrefixInfoExt{PrefixInfo: PrefixInfo{Type: "public"}}
+		if name == "secret" {
+			pInfo.Type = "private"
+		}
+		if err = s.WritePrefixInfo(name, pInfo, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// published private client
+	for path, data := range map[string]string{
+		"secret/hidden/hidden.json":     `{"id":"hidden","type":"release"}`,
+		"secret/hidden/hidden.jar":      "jar",
+		"secret/hidden/data.json":       `{"main":{"hash":"` + sha1Hex("jar") + `","size":3},"libs":{"x/1/x-1.jar":{"hash":"` + sha1Hex("x") + `","size":1}}}`,
+		"secret/versions/versions.json": `{"latest":{"release":"hidden"},"versions":[{"id":"hidden","type":"release"}]}`,
+		"libraries/x/1/x-1.jar":         "x",
+		"public/versions/versions.json": `{"latest":{},"versions":[]}`,
+	} {
+		if err = writeFile(st, path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.updateLists(); err != nil {
+		t.Fatal(err)
+	}
+	if refs, _ := readFile(st, refsFile); !strings.Contains(string(refs), "secret/hidden") {
+		t.Fatalf("%s doesn't refer to the private client:\n%s", refsFile, refs)
+	}
+	token, _, err := s.IssueToken("secret", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	get := func(path, token string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+	}{
+		{"/secret/versions/versions.json", "", http.StatusUnauthorized},
+		{"/secret/hidden/hidden.json", "", http.StatusUnauthorized},
+		{"/secret/hidden/hidden.json", "wrong", http.StatusUnauthorized},
+		{"/secret/hidden/hidden.json", token, http.StatusOK},
+		{"/" + refsFile, "", http.StatusNotFound},
+		{"/" + refsFile, token, http.StatusNotFound},
+		{"/.tokens.json", "", http.StatusNotFound},
+		{"/libraries/x/1/x-1.jar", "", http.StatusOK},
+		{"/public/versions/versions.json", "", http.StatusOK},
+	} {
+		if status, _ := get(tc.path, tc.token); status != tc.status {
+			t.Errorf("GET %s with token \"%s\": got %d, want %d", tc.path, tc.token, status, tc.status)
+		}
+	}
+
+	// the private client isn't visible anywhere without token
+	for _, path := range []string{"/prefixes.json", "/public/versions/versions.json"} {
+		if _, body := get(path, ""); strings.Contains(body, "hidden") || strings.Contains(body, "secret") {
+			t.Errorf("%s exposes the private prefix:\n%s", path, body)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Storage abstracts access to store files.
+// Paths are slash separated and relative to the store root.
+// Missing files are reported with errors satisfying os.IsNotExist.
+type Storage interface {
+	Stat(path string) (FileInfo, error)
+	Open(path string) (io.ReadCloser, error)
+	// Create returns writer, that makes content visible at path only on Commit,
+	// so readers never see partially written files.
+	Create(path string) (AtomicWriter, error)
+	// Remove deletes file, emptied directories are removed as well if backend has any.
+	// Backends, that can't tell whether file existed without extra request, may return nil for missing one.
+	Remove(path string) error
+	// ReadDir lists immediate children of dir.
+	ReadDir(dir string) ([]FileInfo, error)
+	// Walk calls fn for every file under dir in lexical order. Missing dir is not an error.
+	Walk(dir string, fn func(FileInfo) error) error
+}
+
+type AtomicWriter interface {
+	io.Writer
+	// Commit publishes written content.
+	Commit() error
+	// Abort discards written content, does nothing after Commit.
+	Abort() error
+}
+
+type FileInfo struct {
+	// Path relative to store root for Stat and Walk, base name for ReadDir.
+	Path    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+func (fi FileInfo) Name() string {
+	return fi.Path[strings.LastIndex(fi.Path, "/")+1:]
+}
+
+func notExist(op, path string) error {
+	return &os.PathError{Op: op, Path: path, Err: os.ErrNotExist}
+}
+
+func readFile(st Storage, path string) ([]byte, error) {
+	rc, err := st.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func writeFile(st Storage, path string, data []byte) error {
+	w, err := st.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, bytes.NewReader(data)); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Commit()
+}
+
+func readJSON(st Storage, path string, v interface{}) error {
+	rc, err := st.Open(path)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// Linker is implemented by backends able to share file content without copying.
+type Linker interface {
+	Link(from, to string) error
+}
+
+// Renamer is implemented by backends able to move file or directory at once.
+type Renamer interface {
+	Rename(from, to string) error
+}
+
+// Locker is implemented by backends supporting advisory store lock, see Store.Lock.
+type Locker interface {
+	// Lock takes exclusive or shared lock. If lock is held and wait isn't set,
+	// it fails immediately with LockedError.
+	Lock(exclusive, wait bool) (unlock func(), err error)
+}
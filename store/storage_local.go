@@ -0,0 +1,187 @@
+package store
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStorage keeps store in a local directory.
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	return &LocalStorage{filepath.Clean(root)}
+}
+
+func (ls *LocalStorage) full(path string) string {
+	return filepath.Join(ls.root, filepath.FromSlash(path))
+}
+
+func (ls *LocalStorage) Stat(path string) (FileInfo, error) {
+	fi, err := os.Stat(ls.full(path))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return FileInfo{
+		Path:    strings.TrimSuffix(path, "/"),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		IsDir:   fi.IsDir(),
+	}, nil
+}
+
+func (ls *LocalStorage) Open(path string) (io.ReadCloser, error) {
+	return os.Open(ls.full(path))
+}
+
+func (ls *LocalStorage) Create(path string) (AtomicWriter, error) {
+	full := ls.full(path)
+	if err := os.MkdirAll(filepath.Dir(full), os.ModeDir|0755); err != nil {
+		return nil, err
+	}
+	fd, err := ioutil.TempFile(filepath.Dir(full), "."+filepath.Base(full)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{File: fd, dest: full}, nil
+}
+
+type localWriter struct {
+	*os.File
+	dest string
+	done bool
+}
+
+func (lw *localWriter) Commit() error {
+	if lw.done {
+		return nil
+	}
+	lw.done = true
+
+	err := lw.File.Sync()
+	if err == nil {
+		err = lw.File.Chmod(0644)
+	}
+	if cerr := lw.File.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(lw.File.Name(), lw.dest)
+	}
+	if err != nil {
+		_ = os.Remove(lw.File.Name())
+		return err
+	}
+
+	// make rename durable
+	if dir, err := os.Open(filepath.Dir(lw.dest)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	return nil
+}
+
+func (lw *localWriter) Abort() error {
+	if lw.done {
+		return nil
+	}
+	lw.done = true
+	_ = lw.File.Close()
+	return os.Remove(lw.File.Name())
+}
+
+func (ls *LocalStorage) Remove(path string) error {
+	full := ls.full(path)
+	if err := os.Remove(full); err != nil {
+		return err
+	}
+
+	for dir := filepath.Dir(full); dir != ls.root && strings.HasPrefix(dir, ls.root); dir = filepath.Dir(dir) {
+		flist, err := ioutil.ReadDir(dir)
+		if err != nil || len(flist) != 0 {
+			break
+		}
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (ls *LocalStorage) ReadDir(dir string) ([]FileInfo, error) {
+	flist, err := ioutil.ReadDir(ls.full(dir))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]FileInfo, 0, len(flist))
+	for _, fi := range flist {
+		list = append(list, FileInfo{
+			Path:    fi.Name(),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+			IsDir:   fi.IsDir(),
+		})
+	}
+	return list, nil
+}
+
+func (ls *LocalStorage) Walk(dir string, fn func(FileInfo) error) error {
+	root := ls.full(dir)
+	var files []FileInfo
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(ls.root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// collected first, so fn may remove files
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	for _, fi := range files {
+		if err = fn(fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Link creates hard link, so jar of scaffolded client doesn't take space.
+func (ls *LocalStorage) Link(from, to string) error {
+	full := ls.full(to)
+	if err := os.MkdirAll(filepath.Dir(full), os.ModeDir|0755); err != nil {
+		return err
+	}
+	return os.Link(ls.full(from), full)
+}
+
+// Rename moves file or directory, parent directories of destination are created.
+func (ls *LocalStorage) Rename(from, to string) error {
+	full := ls.full(to)
+	if err := os.MkdirAll(filepath.Dir(full), os.ModeDir|0755); err != nil {
+		return err
+	}
+	return os.Rename(ls.full(from), full)
+}
@@ -0,0 +1,122 @@
+//go:build !windows
+// +build !windows
+
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// lockFile is locked with flock, it is never served, as any other dot file.
+const lockFile = ".lock"
+
+// holdersFile lists pid and command of lockFile holders, one line per holder.
+// Holders of shared lock edit it concurrently, so it is edited under its own flock.
+const holdersFile = ".lock.holders"
+
+// Lock takes flock of lockFile in the store root.
+// Lock is released when process exits, even if it crashes.
+func (ls *LocalStorage) Lock(exclusive, wait bool) (func(), error) {
+	fd, err := os.OpenFile(filepath.Join(ls.root, lockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	if err = syscall.Flock(int(fd.Fd()), how); err != nil {
+		defer fd.Close()
+		if err == syscall.EWOULDBLOCK {
+			holder := "another process"
+			if holders := ls.lockHolders(); len(holders) != 0 {
+				holder = strings.Join(holders, ", ")
+			}
+			return nil, &LockedError{Holder: holder}
+		}
+		return nil, err
+	}
+
+	line := fmt.Sprintf("pid %d (%s %s)", os.Getpid(),
+		filepath.Base(os.Args[0]), strings.Join(os.Args[1:], " "))
+	err = ls.editHolders(func(holders []string) []string {
+		return append(holders, line)
+	})
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	return func() {
+		// the same process may hold lock several times, only one line is removed
+		_ = ls.editHolders(func(holders []string) []string {
+			for i, h := range holders {
+				if h == line {
+					return append(holders[:i], holders[i+1:]...)
+				}
+			}
+			return holders
+		})
+		_ = syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+		_ = fd.Close()
+	}, nil
+}
+
+// editHolders rewrites holdersFile with edited list of its alive holders.
+func (ls *LocalStorage) editHolders(edit func([]string) []string) error {
+	fd, err := os.OpenFile(filepath.Join(ls.root, holdersFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	// flock is released by close
+	defer fd.Close()
+	if err = syscall.Flock(int(fd.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	holders := edit(readHolders(fd, false))
+	if err = fd.Truncate(0); err != nil || len(holders) == 0 {
+		return err
+	}
+	_, err = fd.WriteAt([]byte(strings.Join(holders, "\n")+"\n"), 0)
+	return err
+}
+
+// lockHolders returns info of alive lock holders except the current process.
+func (ls *LocalStorage) lockHolders() []string {
+	fd, err := os.Open(filepath.Join(ls.root, holdersFile))
+	if err != nil {
+		return nil
+	}
+	defer fd.Close()
+	if err = syscall.Flock(int(fd.Fd()), syscall.LOCK_SH); err != nil {
+		return nil
+	}
+	return readHolders(fd, true)
+}
+
+// readHolders reads lines of alive processes from holdersFile.
+func readHolders(fd *os.File, skipSelf bool) []string {
+	data, _ := ioutil.ReadAll(fd)
+
+	var holders []string
+	for _, line := range strings.Split(string(data), "\n") {
+		var pid int
+		if _, err := fmt.Sscanf(line, "pid %d", &pid); err != nil || skipSelf && pid == os.Getpid() {
+			continue
+		}
+		if err := syscall.Kill(pid, 0); err == nil || err == syscall.EPERM {
+			holders = append(holders, line)
+		}
+	}
+	return holders
+}
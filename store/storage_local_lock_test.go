@@ -0,0 +1,89 @@
+//go:build !windows
+// +build !windows
+
+package store
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorageLock(t *testing.T) {
+	root := t.TempDir()
+	ls := NewLocalStorage(root)
+	holders := func() int {
+		data, _ := ioutil.ReadFile(filepath.Join(root, holdersFile))
+		return strings.Count(string(data), "\n")
+	}
+
+	unlock1, err := ls.Lock(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock2, err := ls.Lock(false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := holders(); n != 2 {
+		t.Errorf("%d holders listed, want 2", n)
+	}
+	if _, err = ls.Lock(true, false); err == nil {
+		t.Fatal("exclusive lock is taken along with shared ones")
+	} else if _, ok := err.(*LockedError); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// release of one shared lock keeps the other holder
+	unlock1()
+	if n := holders(); n != 1 {
+		t.Errorf("%d holders listed, want 1", n)
+	}
+	unlock2()
+	if n := holders(); n != 0 {
+		t.Errorf("%d holders listed, want 0", n)
+	}
+
+	unlock, err := ls.Lock(true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestProxyLocked(t *testing.T) {
+	asset := "asset"
+	up := &proxyUpstream{requested: make(map[string]int), files: map[string]string{
+		"/assets/" + assetPath(asset): asset,
+	}}
+	upstream := httptest.NewServer(up)
+	defer upstream.Close()
+
+	refs := NewRefIndex()
+	refs.Assets[sha1Hex(asset)] = []string{"1"}
+	ls := NewLocalStorage(t.TempDir())
+	srv := httptest.NewServer(newProxyStore(t, ls, upstream, refs).ProxyHandler(false))
+	defer srv.Close()
+
+	unlock, err := ls.Lock(true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// request isn't held until the lock is released
+	resp, err := http.Get(srv.URL + "/assets/objects/" + assetPath(asset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("got %d with Retry-After \"%s\"", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	unlock()
+	if status, body := proxyGet(t, srv.URL+"/assets/objects/"+assetPath(asset)); status != http.StatusOK || body != asset {
+		t.Errorf("got %d \"%s\" after unlock", status, body)
+	}
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemStorage keeps store in memory, mostly useful for tests.
+type MemStorage struct {
+	mu    sync.RWMutex
+	files map[string]memFile
+}
+
+type memFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{files: make(map[string]memFile)}
+}
+
+func cleanPath(path string) string {
+	return strings.Trim(path, "/")
+}
+
+func (ms *MemStorage) Stat(path string) (FileInfo, error) {
+	path = cleanPath(path)
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if f, ok := ms.files[path]; ok {
+		return FileInfo{Path: path, Size: int64(len(f.data)), ModTime: f.modTime}, nil
+	}
+	for name := range ms.files {
+		if strings.HasPrefix(name, path+"/") || path == "" {
+			return FileInfo{Path: path, IsDir: true}, nil
+		}
+	}
+	return FileInfo{}, notExist("stat", path)
+}
+
+func (ms *MemStorage) Open(path string) (io.ReadCloser, error) {
+	path = cleanPath(path)
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	f, ok := ms.files[path]
+	if !ok {
+		return nil, notExist("open", path)
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (ms *MemStorage) Create(path string) (AtomicWriter, error) {
+	return &memWriter{ms: ms, path: cleanPath(path)}, nil
+}
+
+type memWriter struct {
+	bytes.Buffer
+	ms   *MemStorage
+	path string
+	done bool
+}
+
+func (mw *memWriter) Commit() error {
+	if mw.done {
+		return nil
+	}
+	mw.done = true
+	mw.ms.mu.Lock()
+	mw.ms.files[mw.path] = memFile{mw.Bytes(), time.Now()}
+	mw.ms.mu.Unlock()
+	return nil
+}
+
+func (mw *memWriter) Abort() error {
+	mw.done = true
+	return nil
+}
+
+func (ms *MemStorage) Remove(path string) error {
+	path = cleanPath(path)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.files[path]; !ok {
+		return notExist("remove", path)
+	}
+	delete(ms.files, path)
+	return nil
+}
+
+func (ms *MemStorage) ReadDir(dir string) ([]FileInfo, error) {
+	dir = cleanPath(dir)
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var list []FileInfo
+	for name, f := range ms.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := name[len(prefix):]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			if !seen[rest[:i]] {
+				seen[rest[:i]] = true
+				list = append(list, FileInfo{Path: rest[:i], IsDir: true})
+			}
+			continue
+		}
+		list = append(list, FileInfo{Path: rest, Size: int64(len(f.data)), ModTime: f.modTime})
+	}
+	if len(list) == 0 {
+		return nil, notExist("readdir", dir)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+func (ms *MemStorage) Walk(dir string, fn func(FileInfo) error) error {
+	prefix := cleanPath(dir) + "/"
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	ms.mu.RLock()
+	var files []FileInfo
+	for name, f := range ms.files {
+		if strings.HasPrefix(name, prefix) {
+			files = append(files, FileInfo{Path: name, Size: int64(len(f.data)), ModTime: f.modTime})
+		}
+	}
+	ms.mu.RUnlock()
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	for _, fi := range files {
+		if err := fn(fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,379 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type S3Config struct {
+	// Service endpoint, e.g. "https://s3.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Optional key prefix inside bucket.
+	Prefix string
+
+	AccessKey, SecretKey string
+
+	// http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// S3Storage keeps store in S3-compatible object storage.
+// Requests use path-style addressing and AWS signature version 4.
+type S3Storage struct {
+	cfg S3Config
+}
+
+func NewS3Storage(cfg S3Config) *S3Storage {
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	cfg.Prefix = cleanPath(cfg.Prefix)
+	if cfg.Prefix != "" {
+		cfg.Prefix += "/"
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &S3Storage{cfg}
+}
+
+func (ss *S3Storage) key(path string) string {
+	return ss.cfg.Prefix + cleanPath(path)
+}
+
+func (ss *S3Storage) Stat(path string) (FileInfo, error) {
+	resp, err := ss.do("HEAD", ss.key(path), nil, emptyHash, nil, 0)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		mtime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return FileInfo{Path: cleanPath(path), Size: resp.ContentLength, ModTime: mtime}, nil
+
+	case http.StatusNotFound:
+		// may be a "directory"
+		list, err := ss.list(ss.key(path)+"/", "/", 1, "")
+		if err != nil {
+			return FileInfo{}, err
+		}
+		if len(list.Contents) == 0 && len(list.CommonPrefixes) == 0 {
+			return FileInfo{}, notExist("stat", path)
+		}
+		return FileInfo{Path: cleanPath(path), IsDir: true}, nil
+
+	default:
+		return FileInfo{}, fmt.Errorf("s3 stat \"%s\": %s", path, resp.Status)
+	}
+}
+
+func (ss *S3Storage) Open(path string) (io.ReadCloser, error) {
+	resp, err := ss.do("GET", ss.key(path), nil, emptyHash, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, ss.fail(resp, "open", path)
+	}
+	return resp.Body, nil
+}
+
+func (ss *S3Storage) Create(path string) (AtomicWriter, error) {
+	fd, err := ioutil.TempFile("", "ttyhstore-s3-")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Writer{ss: ss, path: path, fd: fd, sha: sha256.New()}, nil
+}
+
+// s3Writer spools content to a temporary file and uploads it on Commit.
+// Single PUT is atomic in S3.
+type s3Writer struct {
+	ss   *S3Storage
+	path string
+	fd   *os.File
+	sha  hash.Hash
+	size int64
+	done bool
+}
+
+func (sw *s3Writer) Write(p []byte) (int, error) {
+	n, err := sw.fd.Write(p)
+	sw.sha.Write(p[:n])
+	sw.size += int64(n)
+	return n, err
+}
+
+func (sw *s3Writer) Commit() error {
+	if sw.done {
+		return nil
+	}
+	sw.done = true
+	defer os.Remove(sw.fd.Name())
+	defer sw.fd.Close()
+
+	if _, err := sw.fd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	resp, err := sw.ss.do("PUT", sw.ss.key(sw.path), nil, hex.EncodeToString(sw.sha.Sum(nil)), sw.fd, sw.size)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return sw.ss.fail(resp, "create", sw.path)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (sw *s3Writer) Abort() error {
+	if sw.done {
+		return nil
+	}
+	sw.done = true
+	_ = sw.fd.Close()
+	return os.Remove(sw.fd.Name())
+}
+
+// Remove deletes object at once, S3 doesn't report whether it existed,
+// so missing file isn't an error here.
+func (ss *S3Storage) Remove(path string) error {
+	resp, err := ss.do("DELETE", ss.key(path), nil, emptyHash, nil, 0)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return ss.fail(resp, "remove", path)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (ss *S3Storage) ReadDir(dir string) ([]FileInfo, error) {
+	prefix := ss.key(dir)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var list []FileInfo
+	token := ""
+	for {
+		res, err := ss.list(prefix, "/", 1000, token)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range res.CommonPrefixes {
+			list = append(list, FileInfo{Path: strings.TrimSuffix(p.Prefix[len(prefix):], "/"), IsDir: true})
+		}
+		for _, c := range res.Contents {
+			list = append(list, FileInfo{Path: c.Key[len(prefix):], Size: c.Size, ModTime: c.LastModified})
+		}
+		if !res.IsTruncated {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+
+	if len(list) == 0 {
+		return nil, notExist("readdir", dir)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list, nil
+}
+
+func (ss *S3Storage) Walk(dir string, fn func(FileInfo) error) error {
+	prefix := ss.key(dir)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	token := ""
+	for {
+		res, err := ss.list(prefix, "", 1000, token)
+		if err != nil {
+			return err
+		}
+		for _, c := range res.Contents {
+			err = fn(FileInfo{
+				Path:    strings.TrimPrefix(c.Key, ss.cfg.Prefix),
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if !res.IsTruncated {
+			return nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (ss *S3Storage) list(prefix, delimiter string, max int, token string) (*s3ListResult, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"max-keys":  {strconv.Itoa(max)},
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+
+	resp, err := ss.do("GET", "", query, emptyHash, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, ss.fail(resp, "list", prefix)
+	}
+
+	var res s3ListResult
+	if err = xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("s3 list \"%s\": %v", prefix, err)
+	}
+	return &res, nil
+}
+
+func (ss *S3Storage) fail(resp *http.Response, op, path string) error {
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notExist(op, path)
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s \"%s\": %s %s", op, path, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// sha256 of empty payload
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// do sends signed request for key in bucket or for bucket itself if key is empty.
+func (ss *S3Storage) do(method, key string, query url.Values,
+	payloadHash string, body io.Reader, size int64) (*http.Response, error) {
+	path := "/" + ss.cfg.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	rawQuery := canonicalQuery(query)
+
+	u := ss.cfg.Endpoint + uriEncode(path, false)
+	if rawQuery != "" {
+		u += "?" + rawQuery
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	ss.sign(req, uriEncode(path, false), rawQuery, payloadHash, time.Now().UTC())
+	return ss.cfg.Client.Do(req)
+}
+
+func (ss *S3Storage) sign(req *http.Request, canonicalURI, rawQuery, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, canonicalURI, rawQuery, canonicalHeaders, signed, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + ss.cfg.Region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+ss.cfg.SecretKey), date)
+	key = hmacSHA256(key, ss.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+ss.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes everything except unreserved characters as required by signature v4.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
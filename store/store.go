@@ -0,0 +1,241 @@
+// Package store manages unofficial minecraft update server storage:
+// client checking, versions.json generation,
+// libraries and assets download and cleanup.
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var (
+	specialDirs = []string{"libraries", "assets"}
+
+	osList   = []string{"linux", "windows", "osx" /*, "MS-DOS"*/}
+	archList = []string{ /*"3.14", "8", "16",*/ "32", "64" /*, "128"*/}
+)
+
+const overwriteFile = "overwrite.list"
+
+// Upstream defines official repositories missing files are downloaded from.
+type Upstream struct {
+	Manifest, Libraries, Indexes, Assets string
+}
+
+var DefaultUpstream = Upstream{
+	Manifest:  "https://launchermeta.mojang.com/mc/game/version_manifest.json",
+	Libraries: "https://libraries.minecraft.net/",
+	Indexes:   "https://s3.amazonaws.com/Minecraft.Download/indexes/",
+	Assets:    "https://resources.download.minecraft.net/",
+}
+
+type Options struct {
+	// Storage root directory, used if Storage isn't set.
+	Root string
+	// Storage backend, LocalStorage in Root if nil.
+	Storage Storage
+	// Upstream repositories, DefaultUpstream if empty.
+	Upstream Upstream
+	// Progress output, nil disables it.
+	// Details about already checked or existing files and downloads are logged at debug level.
+	Log *Logger
+	// Replace existing libraries if they do not match expectations.
+	Replace bool
+	// Check all clients while collect, even unchanged ones.
+	Full bool
+	// Don't download anything, missing files are listed by Store.Missing.
+	Offline bool
+	// Number of clients checked concurrently while collect, number of CPUs if 0.
+	Jobs int
+	// Additional hash algorithms recorded in data.json, sha1 is always present.
+	Hashes []string
+	// Format version of generated files, the latest if 0.
+	Format int
+	// Manual latest versions, "<prefix>/<type>" -> "<version>".
+	Latest map[string]string
+	// Versions skipped while collect, "<prefix>/<version>".
+	Ignore []string
+	// Structured progress events, may be called concurrently.
+	Events func(Event)
+}
+
+type Store struct {
+	st       Storage
+	upstream Upstream
+	log      *Logger
+
+	replace, full, offline bool
+
+	jobs   int
+	hashes []string
+	format int
+
+	customLast   map[string]string
+	ignoreList   map[string]bool
+	libOverwrite []*regexp.Regexp
+
+	checked   *checkedSet
+	missing   missingSet
+	collected bool
+	invalids  bool
+
+	events func(Event)
+}
+
+func New(opts Options) (*Store, error) {
+	if opts.Root == "" && opts.Storage == nil {
+		return nil, fmt.Errorf("store root not defined")
+	}
+
+	s := &Store{
+		st:         opts.Storage,
+		upstream:   opts.Upstream,
+		log:        opts.Log,
+		replace:    opts.Replace,
+		full:       opts.Full,
+		offline:    opts.Offline,
+		jobs:       opts.Jobs,
+		format:     opts.Format,
+		customLast: make(map[string]string),
+		ignoreList: make(map[string]bool),
+		checked:    newCheckedSet(),
+		events:     opts.Events,
+	}
+
+	if s.st == nil {
+		s.st = NewLocalStorage(opts.Root)
+	}
+	if s.upstream == (Upstream{}) {
+		s.upstream = DefaultUpstream
+	}
+	if s.log == nil {
+		s.log = discardLogger()
+	}
+	if s.jobs < 1 {
+		s.jobs = runtime.NumCPU()
+	}
+
+	if s.format == 0 {
+		s.format = FormatVersion
+	}
+	if s.format < 1 || s.format > FormatVersion {
+		return nil, fmt.Errorf("unsupported format %d, expected 1..%d", s.format, FormatVersion)
+	}
+
+	for _, name := range opts.Hashes {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "sha1" {
+			continue
+		}
+		if _, ok := hashFuncs[name]; !ok {
+			return nil, fmt.Errorf("unsupported hash algorithm \"%s\"", name)
+		}
+		if !inSlice(name, s.hashes) {
+			s.hashes = append(s.hashes, name)
+		}
+	}
+
+	for k, v := range opts.Latest {
+		s.customLast[k] = v
+	}
+	for _, item := range opts.Ignore {
+		s.ignoreList[item] = true
+	}
+
+	err := s.readLibOverwrite()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare lib overwrite: %v", err)
+	}
+
+	return s, nil
+}
+
+// Storage returns backend store files are kept in.
+func (s *Store) Storage() Storage {
+	return s.st
+}
+
+// IsSpecialDir reports whether name is reserved for shared store data and can't be used as prefix.
+func IsSpecialDir(name string) bool {
+	return inSlice(name, specialDirs)
+}
+
+func (s *Store) readLibOverwrite() error {
+	fd, err := s.st.Open("libraries/" + overwriteFile)
+	switch {
+	case err == nil:
+
+	case os.IsNotExist(err):
+		// whatever
+		return nil
+
+	default:
+		return err
+	}
+
+	defer fd.Close()
+
+	sc := bufio.NewScanner(fd)
+	for sc.Scan() {
+		if sc.Text() == "" {
+			continue
+		}
+		r, err := regexp.Compile(sc.Text())
+		if err != nil {
+			return fmt.Errorf("%v : %v", sc.Text(), err)
+		}
+		s.libOverwrite = append(s.libOverwrite, r)
+	}
+	return sc.Err()
+}
+
+// Check checks whatever client is consistent,
+// downloads missing libraries and assets and writes data.json.
+func (s *Store) Check(prefix, version string) (*VInfoFull, error) {
+	w := s.newWorker()
+	info, err := w.checkCli(prefix+"/"+version+"/", false)
+	w.reportCheck(err, false)
+	return info, err
+}
+
+// Cleanup deletes all libraries and assets, that aren't required by any client.
+// Runs Collect first unless it was already done by this Store.
+func (s *Store) Cleanup() error {
+	if !s.collected {
+		if err := s.Collect(); err != nil {
+			return err
+		}
+	}
+	if s.invalids {
+		return fmt.Errorf("cleanup aborted in case of invalid cli")
+	}
+	return s.clean()
+}
+
+func (s *Store) prefixDirs() ([]FileInfo, error) {
+	dir, err := s.st.ReadDir("")
+	if err != nil {
+		return nil, err
+	}
+	prefixes := dir[:0]
+	for _, fi := range dir {
+		if !fi.IsDir || inSlice(fi.Name(), specialDirs) || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		prefixes = append(prefixes, fi)
+	}
+	return prefixes, nil
+}
+
+func inSlice(val string, sli []string) bool {
+	for _, t := range sli {
+		if val == t {
+			return true
+		}
+	}
+	return false
+}
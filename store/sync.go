@@ -0,0 +1,154 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	manifestPath = "version_manifest.json"
+	// manifestMetaFile keeps validators of the manifest for conditional requests.
+	manifestMetaFile = ".version_manifest.meta.json"
+	// syncStatusFile keeps SyncStatus of the last sync.
+	syncStatusFile = ".sync-status.json"
+)
+
+type manifestMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// SyncStatus describes the last sync run.
+type SyncStatus struct {
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// manifest was changed since the last successful sync
+	Modified bool     `json:"modified"`
+	Cloned   []string `json:"cloned,omitempty"`
+	Err      string   `json:"error,omitempty"`
+}
+
+// Sync clones versions selected by filter, that are missing in prefix, and collects the store
+// if anything was cloned. Manifest is requested conditionally, so nothing is done
+// until it is changed since the last successful sync. Store lock is held while sync.
+// Status is returned and written to syncStatusFile in the store root.
+// Store keeps state of the run like collect does, so use new Store for every sync.
+func (s *Store) Sync(prefix string, filter CloneFilter) *SyncStatus {
+	status := &SyncStatus{Started: time.Now().UTC().Truncate(time.Second)}
+	if err := s.sync(prefix, filter, status); err != nil {
+		status.Err = err.Error()
+	}
+	status.Finished = time.Now().UTC().Truncate(time.Second)
+
+	data, _ := json.MarshalIndent(status, "", "  ")
+	if err := writeFile(s.st, syncStatusFile, data); err != nil {
+		s.warnf("Failed to write %s: %v", syncStatusFile, err)
+	}
+	return status
+}
+
+func (s *Store) sync(prefix string, filter CloneFilter, status *SyncStatus) error {
+	if s.offline {
+		return fmt.Errorf("sync isn't possible in offline mode")
+	}
+	if filter.Empty() {
+		return fmt.Errorf("no versions selected by empty filter")
+	}
+
+	unlock, err := s.Lock(true, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	w := s.newWorker()
+	manifest, meta, err := w.getManifestIfModified()
+	if err != nil || manifest == nil {
+		return err
+	}
+	status.Modified = true
+
+	plan, err := w.planClone(manifest, prefix, nil, filter)
+	if err != nil {
+		return err
+	}
+	for _, v := range plan.Versions {
+		if v.Exists {
+			continue
+		}
+		if err = w.clone(prefix, v); err != nil {
+			return fmt.Errorf("clone version \"%s\" failed: %v", v.Id, err)
+		}
+		status.Cloned = append(status.Cloned, v.Id)
+	}
+
+	if len(status.Cloned) != 0 {
+		if err = s.Collect(); err != nil {
+			return err
+		}
+	}
+
+	// manifest isn't skipped next time unless everything is done
+	data, _ := json.MarshalIndent(meta, "", "  ")
+	return writeFile(s.st, manifestMetaFile, data)
+}
+
+// getManifestIfModified downloads version manifest from upstream unless it is
+// the same as the stored one. Nil manifest is returned if it isn't modified.
+func (w *worker) getManifestIfModified() (*VersionManifest, *manifestMeta, error) {
+	var meta manifestMeta
+	if _, err := w.st.Stat(manifestPath); err == nil {
+		_ = readJSON(w.st, manifestMetaFile, &meta)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, w.upstream.Manifest, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	w.log.Debugf("Getting file \"%s\"...", manifestPath)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		w.log.Println("Manifest isn't modified")
+		return nil, nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("loading \"%s\" failed with status \"%s\"", w.upstream.Manifest, resp.Status)
+	}
+
+	fd, err := w.st.Create(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fd.Abort()
+	if _, err = io.Copy(fd, resp.Body); err != nil {
+		return nil, nil, err
+	}
+	if err = fd.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	var manifest VersionManifest
+	if err = readJSON(w.st, manifestPath, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode version manifest: %v", err)
+	}
+	meta = manifestMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	return &manifest, &meta, nil
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// tokensFile keeps access tokens of private prefixes.
+// It is never served, as any other dot file.
+const tokensFile = ".tokens.json"
+
+// Token grants access to private prefix. Only hash of the token itself is kept.
+type Token struct {
+	ID      string    `json:"id"`
+	Hash    string    `json:"hash"`
+	About   string    `json:"about,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// prefix -> tokens
+type tokenList map[string][]Token
+
+func (s *Store) readTokens() (tokenList, error) {
+	tokens := make(tokenList)
+	err := readJSON(s.st, tokensFile, &tokens)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse %s: %v", tokensFile, err)
+	}
+	return tokens, nil
+}
+
+func (s *Store) writeTokens(tokens tokenList) error {
+	data, _ := json.MarshalIndent(tokens, "", "  ")
+	return writeFile(s.st, tokensFile, data)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueToken creates new access token for private prefix.
+// Token is returned only once, store keeps its hash.
+func (s *Store) IssueToken(prefix, about string) (token string, info Token, err error) {
+	pInfo, err := s.PrefixInfo(prefix)
+	if err != nil {
+		return "", Token{}, err
+	}
+	if pInfo.Type != "private" {
+		return "", Token{}, fmt.Errorf("prefix \"%s\" isn't private, tokens won't be checked", prefix)
+	}
+
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", Token{}, err
+	}
+	token = hex.EncodeToString(raw)
+	hash := hashToken(token)
+	info = Token{
+		ID:      hash[:8],
+		Hash:    hash,
+		About:   about,
+		Created: time.Now().UTC().Truncate(time.Second),
+	}
+
+	tokens, err := s.readTokens()
+	if err != nil {
+		return "", Token{}, err
+	}
+	tokens[prefix] = append(tokens[prefix], info)
+	if err = s.writeTokens(tokens); err != nil {
+		return "", Token{}, fmt.Errorf("failed to write %s: %v", tokensFile, err)
+	}
+	return token, info, nil
+}
+
+// RevokeToken deletes token of prefix by its id.
+func (s *Store) RevokeToken(prefix, id string) error {
+	tokens, err := s.readTokens()
+	if err != nil {
+		return err
+	}
+
+	list := tokens[prefix]
+	for i, t := range list {
+		if t.ID != id {
+			continue
+		}
+		tokens[prefix] = append(list[:i], list[i+1:]...)
+		if len(tokens[prefix]) == 0 {
+			delete(tokens, prefix)
+		}
+		if err = s.writeTokens(tokens); err != nil {
+			return fmt.Errorf("failed to write %s: %v", tokensFile, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("token \"%s\" of prefix \"%s\" not found", id, prefix)
+}
+
+// Tokens lists tokens of prefix, sorted by creation time.
+func (s *Store) Tokens(prefix string) ([]Token, error) {
+	tokens, err := s.readTokens()
+	if err != nil {
+		return nil, err
+	}
+	list := tokens[prefix]
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// checkToken reports whether token grants access to prefix.
+func (s *Store) checkToken(prefix, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	tokens, err := s.readTokens()
+	if err != nil {
+		return false, err
+	}
+	hash := []byte(hashToken(token))
+	for _, t := range tokens[prefix] {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,8 +1,6 @@
-package main
+package store
 
-import (
-	"time"
-)
+import "time"
 
 type VersionManifest struct {
 	Latest   map[string]string `json:"latest"`
@@ -19,9 +17,10 @@ type VInfoMin struct {
 }
 
 type Download struct {
-	URL  string `json:"url"`
-	Size int64  `json:"size"`
-	SHA1 string `json:"sha1"`
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 func (dl Download) Match(info FInfo) bool {
@@ -31,20 +30,33 @@ func (dl Download) Match(info FInfo) bool {
 	if dl.SHA1 != "" && info.Hash != dl.SHA1 {
 		return false
 	}
+	if dl.SHA256 != "" && info.SHA256 != dl.SHA256 {
+		return false
+	}
 	return true
 }
 
+// Algos lists hash algorithms required to match download besides default ones.
+func (dl Download) Algos() []string {
+	if dl.SHA256 != "" {
+		return []string{"sha256"}
+	}
+	return nil
+}
+
 func (dl Download) ToFInfo() FInfo {
 	return FInfo{
-		Hash: dl.SHA1,
-		Size: dl.Size,
+		Hash:   dl.SHA1,
+		SHA256: dl.SHA256,
+		Size:   dl.Size,
 	}
 }
 
 type Prefix struct {
-	Latest     map[string]string    `json:"latest"`
-	latestTime map[string]time.Time //not in json
-	Versions   []*VInfoMin          `json:"versions"`
+	FormatVersion int                  `json:"formatVersion,omitempty"`
+	Latest        map[string]string    `json:"latest"`
+	latestTime    map[string]time.Time //not in json
+	Versions      []*VInfoMin          `json:"versions"`
 }
 
 func NewPrefix() *Prefix {
@@ -126,7 +138,9 @@ func NewObjectList() *ObjectList {
 
 type FInfo struct {
 	Hash string `json:"hash"`
-	Size int64  `json:"size"`
+	// optional, see --hash
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
 }
 type FIndex map[string]FInfo
 
@@ -140,9 +154,10 @@ func NewCustoms() *Customs {
 }
 
 type FilesInfo struct {
-	Main  FInfo    `json:"main"`
-	Libs  FIndex   `json:"libs"`
-	Files *Customs `json:"files"`
+	FormatVersion int      `json:"formatVersion,omitempty"`
+	Main          FInfo    `json:"main"`
+	Libs          FIndex   `json:"libs"`
+	Files         *Customs `json:"files"`
 }
 
 func NewFilesInfo() *FilesInfo {
@@ -162,58 +177,10 @@ type PrefixInfoExt struct {
 }
 
 type PrefixList struct {
-	Prefixes map[string]PrefixInfo `json:"prefixes"`
+	FormatVersion int                   `json:"formatVersion,omitempty"`
+	Prefixes      map[string]PrefixInfo `json:"prefixes"`
 }
 
 func NewPrefixList() *PrefixList {
-	return &PrefixList{make(map[string]PrefixInfo)}
-}
-
-var helpMessage = `Usage: %s [options] [command] [args]
-
-Commands:
-	
-	check [<prefix1>/]<version1> [[<prefix2>/]<version2>] [...]
-		Check whatever specified clients are consistent,
-		if possible download missing files from official repos.
-		If prefix isn't provided will search in default.
-	
-	collect
-		Check all client versions,
-		geneate new versions.json in all prefixes.
-		
-	clone <off_version1> [<off_version2>] [...]
-		Clone clients from official repos to default prefix.
-		
-	help
-		Show this message.
-		
-	cleanup
-		Alias to "--cleanup collect"
-		
-Options:
-	
-	-v
-		Be more verbose.
-		
-	--root=<path>
-		Overwrite storage root, default may be set by $TTYH_STORE env variable.
-		
-	--ignore=<prefix1>/<version1>[,<prefix2>/<version2>][...]
-		Don't check specified versions while collect.
-		
-	--prefix=<prefix>
-		Set default prefix for clone or check. Predefined is "default".
-		
-	--last=<prefix1>/<type1>:<version1>[,<prefix2>/<type2>:<version2>][...]
-		Overwrite latest versions in versions.json manually.
-		Default choice based on releaseTime in <version>.json.
-		
-	--cleanup
-		After collect delete all libraries and assets,
-		that aren't required by any client.
-		Cleanup will be abort if any of clients is inconsistent.
-	
-	--replace
-		Replace existing libraries if they do not match expectations.
-`
+	return &PrefixList{Prefixes: make(map[string]PrefixInfo)}
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// upstreamFile keeps upstream <version>.json of cloned client as it was downloaded.
+// It is compared with the current upstream one and serves as base to find local overrides.
+const upstreamFile = ".upstream.json"
+
+// UpstreamChange describes cloned client re-published upstream since it was cloned.
+type UpstreamChange struct {
+	// "<prefix>/<version>"
+	Client string
+	Err    error
+	// sha1 of upstream <version>.json at clone time and the current one
+	From, To string
+	// top-level fields changed upstream
+	Fields []string
+	Libs   []LibChange
+	// fields changed locally, they are kept on update
+	Overrides []string
+	Updated   bool
+}
+
+func (c *UpstreamChange) Empty() bool {
+	return c.Err == nil && c.From == c.To
+}
+
+// UpstreamCheck compares upstream <version>.json of cloned client with the one it was cloned from.
+// If update is set, changed client is re-cloned: fields changed upstream are taken,
+// unless they were changed locally, and client is checked. It is published on the next collect.
+// Clients cloned without upstreamFile are compared by their <version>.json,
+// but can't be updated, since their local overrides are unknown.
+func (s *Store) UpstreamCheck(prefix, version string, update bool) *UpstreamChange {
+	w := s.newWorker()
+	manifest, err := w.getManifest()
+	if err != nil {
+		return &UpstreamChange{Client: prefix + "/" + version, Err: err}
+	}
+	return w.upstreamCheck(manifest, prefix, version, update)
+}
+
+// UpstreamCheckAll runs UpstreamCheck for all clients with upstreamFile.
+func (s *Store) UpstreamCheckAll(update bool) ([]*UpstreamChange, error) {
+	w := s.newWorker()
+	manifest, err := w.getManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return nil, fmt.Errorf("can't read store root directory: %v", err)
+	}
+
+	var changes []*UpstreamChange
+	for _, pfi := range dir {
+		prefix := pfi.Name()
+		vdir, err := s.st.ReadDir(prefix + "/")
+		if err != nil {
+			return nil, fmt.Errorf("can't read prefix root directory: %v", err)
+		}
+		for _, fi := range vdir {
+			if !fi.IsDir || fi.Name() == "versions" || s.ignoreList[prefix+"/"+fi.Name()] {
+				continue
+			}
+			if _, err := s.st.Stat(prefix + "/" + fi.Name() + "/" + upstreamFile); err != nil {
+				continue
+			}
+			changes = append(changes, w.upstreamCheck(manifest, prefix, fi.Name(), update))
+		}
+	}
+	return changes, nil
+}
+
+func (w *worker) upstreamCheck(manifest *VersionManifest, prefix, version string, update bool) *UpstreamChange {
+	c := &UpstreamChange{Client: prefix + "/" + version}
+	versionRoot := prefix + "/" + version + "/"
+	jsonPath := versionRoot + version + ".json"
+
+	basePath := versionRoot + upstreamFile
+	tracked := true
+	if _, err := w.st.Stat(basePath); os.IsNotExist(err) {
+		basePath, tracked = jsonPath, false
+	}
+	base, err := w.fileInfo(basePath)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+
+	v, ok := manifest.find(version)
+	if !ok {
+		c.Err = fmt.Errorf("version not found in manifest")
+		return c
+	}
+
+	newPath := versionRoot + ".upstream.new.json"
+	dl := &Download{URL: v.URL}
+	if c.Err = w.getFile(dl, newPath); c.Err != nil {
+		return c
+	}
+	defer w.st.Remove(newPath)
+	// both hashes are known only now, otherwise failed client would look changed
+	c.From, c.To = base.Hash, dl.SHA1
+	if c.Empty() {
+		return c
+	}
+
+	var baseFields, newFields, localFields map[string]json.RawMessage
+	for path, fields := range map[string]*map[string]json.RawMessage{
+		basePath: &baseFields, newPath: &newFields, jsonPath: &localFields,
+	} {
+		if err := readJSON(w.st, path, fields); err != nil {
+			c.Err = fmt.Errorf("failed to parse %s: %v", path, err)
+			return c
+		}
+	}
+
+	var baseInfo, newInfo VInfoFull
+	_ = json.Unmarshal(baseFields["libraries"], &baseInfo.Libs)
+	_ = json.Unmarshal(newFields["libraries"], &newInfo.Libs)
+	c.Libs = diffLibs(baseInfo.Libs, newInfo.Libs)
+	c.Fields = diffFields(baseFields, newFields)
+	if tracked {
+		c.Overrides = diffFields(baseFields, localFields)
+	}
+
+	if !update {
+		return c
+	}
+	if !tracked {
+		c.Err = fmt.Errorf("%s not found, local overrides are unknown", upstreamFile)
+		return c
+	}
+
+	for _, field := range c.Overrides {
+		if value, ok := localFields[field]; ok {
+			newFields[field] = value
+		} else {
+			delete(newFields, field)
+		}
+	}
+	data, err := json.MarshalIndent(newFields, "", "  ")
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	// check downloads new jar over the current one, both are restored if it fails
+	local, err := readFile(w.st, jsonPath)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	jarPath, jarBackup := versionRoot+version+".jar", versionRoot+".upstream.jar"
+	err = copyFile(w.st, jarPath, jarBackup)
+	hasJar := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		c.Err = fmt.Errorf("failed to back up %s.jar: %v", version, err)
+		return c
+	}
+	defer w.st.Remove(jarBackup)
+
+	if err = writeFile(w.st, jsonPath, data); err != nil {
+		c.Err = fmt.Errorf("failed to write %s.json: %v", version, err)
+		return c
+	}
+	if _, c.Err = w.checkCli(versionRoot, true); c.Err != nil {
+		// client stays as it was, so update may be retried
+		if err = writeFile(w.st, jsonPath, local); err != nil {
+			w.warnf("Failed to restore %s.json: %v", version, err)
+		}
+		if hasJar {
+			err = copyFile(w.st, jarBackup, jarPath)
+		} else {
+			err = w.st.Remove(jarPath)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			w.warnf("Failed to restore %s.jar: %v", version, err)
+		}
+		return c
+	}
+	// base is updated along with the client, otherwise fields merged now would look like overrides
+	if err = moveFile(w.st, newPath, basePath); err != nil {
+		c.Err = fmt.Errorf("failed to save %s: %v", upstreamFile, err)
+		return c
+	}
+	w.log.Printf("Client \"%s\" updated from upstream", c.Client)
+	c.Updated = true
+	return c
+}
+
+// diffFields returns sorted top-level fields, that differ in a and b.
+func diffFields(a, b map[string]json.RawMessage) []string {
+	var diff []string
+	for field, av := range a {
+		if bv, ok := b[field]; !ok || !sameJSON(av, bv) {
+			diff = append(diff, field)
+		}
+	}
+	for field := range b {
+		if _, ok := a[field]; !ok {
+			diff = append(diff, field)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// sameJSON compares decoded values, so formatting and key order don't matter.
+func sameJSON(a, b json.RawMessage) bool {
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamUpdateFailed(t *testing.T) {
+	files := map[string]string{"/old.jar": "old jar", "/new.jar": "new jar"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := files[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write([]byte(data))
+	}))
+	defer srv.Close()
+
+	client := func(jar, libs string) string {
+		return fmt.Sprintf(`{"id":"1","type":"release","downloads":{"client":{"url":"%s/%s","sha1":"%s","size":%d}},"libraries":[%s]}`,
+			srv.URL, jar, sha1Hex(files["/"+jar]), len(files["/"+jar]), libs)
+	}
+	old := client("old.jar", "")
+	// the jar is replaced by check, then it fails on the missing library
+	files["/1.json"] = client("new.jar", `{"name":"a:b:1","downloads":{"artifact":{"path":"a/b/1/b-1.jar","url":"`+
+		srv.URL+`/b-1.jar","sha1":"`+sha1Hex("b")+`","size":1}}}`)
+	files["/manifest.json"] = `{"latest":{},"versions":[{"id":"1","type":"release","url":"` + srv.URL + `/1.json"}]}`
+
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st, Upstream: Upstream{
+		Manifest:  srv.URL + "/manifest.json",
+		Libraries: srv.URL + "/libraries/",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{
+		"default/1/1.json":          old,
+		"default/1/" + upstreamFile: old,
+		"default/1/1.jar":           "old jar",
+	} {
+		if err = writeFile(st, path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := s.UpstreamCheck("default", "1", true)
+	if c.Err == nil || c.Updated {
+		t.Fatalf("update succeeded: %+v", c)
+	}
+	if c.From != sha1Hex(old) || c.To != sha1Hex(files["/1.json"]) {
+		t.Errorf("json sha1 %s -> %s", c.From, c.To)
+	}
+	checkContent(t, st, "default/1/1.json", old)
+	checkContent(t, st, "default/1/1.jar", "old jar")
+	checkContent(t, st, "default/1/"+upstreamFile, old)
+}
+
+func TestUpstreamCheckNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte(`{"latest":{},"versions":[]}`))
+	}))
+	defer srv.Close()
+
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st, Upstream: Upstream{Manifest: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFile(st, "default/1/"+upstreamFile, []byte(`{"id":"1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// failed client isn't reported as changed
+	if c := s.UpstreamCheck("default", "1", false); c.Err == nil || c.From != c.To {
+		t.Errorf("got %+v", c)
+	}
+}
@@ -0,0 +1,163 @@
+package store
+
+import "fmt"
+
+// SharedSize splits size of objects used by client or prefix.
+type SharedSize struct {
+	// used by others as well
+	Shared int64 `json:"shared"`
+	// used only here, freed on delete
+	Unique int64 `json:"unique"`
+}
+
+func (ss *SharedSize) add(size int64, unique bool) {
+	if unique {
+		ss.Unique += size
+	} else {
+		ss.Shared += size
+	}
+}
+
+type VersionUsage struct {
+	Version string `json:"version"`
+	// jar may be shared by clients made with new --link
+	Jar    int64      `json:"jar"`
+	Files  int64      `json:"files"`
+	Libs   SharedSize `json:"libs"`
+	Assets SharedSize `json:"assets"`
+	// space freed if version is deleted
+	Freed int64 `json:"freed"`
+}
+
+type PrefixUsage struct {
+	Prefix   string          `json:"prefix"`
+	Versions []*VersionUsage `json:"versions"`
+	Libs     SharedSize      `json:"libs"`
+	Assets   SharedSize      `json:"assets"`
+	// space freed if whole prefix is deleted
+	Freed int64 `json:"freed"`
+}
+
+// DiskUsage reports sizes of published clients based on data.json and assets indexes.
+// Jars, libraries and assets with their indexes are counted as unique, if they aren't used
+// by any other client (or prefix for prefix totals). Jars are told apart by hash.
+func (s *Store) DiskUsage() ([]*PrefixUsage, error) {
+	dir, err := s.prefixDirs()
+	if err != nil {
+		return nil, fmt.Errorf("can't read store root directory: %v", err)
+	}
+	prefixes := make([]string, 0, len(dir))
+	for _, fi := range dir {
+		if _, err := s.st.Stat(fi.Name() + "/versions/versions.json"); err == nil {
+			prefixes = append(prefixes, fi.Name())
+		}
+	}
+
+	clients, err := s.publishedClients(prefixes)
+	if err != nil {
+		return nil, err
+	}
+
+	// object -> number of clients and set of prefixes using it
+	type users struct {
+		clients  int
+		prefixes map[string]bool
+	}
+	jars := make(map[string]*users)
+	libs := make(map[string]*users)
+	assets := make(map[string]*users)
+	use := func(m map[string]*users, key, prefix string) {
+		u, ok := m[key]
+		if !ok {
+			u = &users{prefixes: make(map[string]bool)}
+			m[key] = u
+		}
+		u.clients++
+		u.prefixes[prefix] = true
+	}
+
+	// assets objects and indexes of clients, index sizes are shared by clients
+	indexSizes := make(map[string]int64)
+	clientAssets := make(map[*publishedClient]map[string]int64)
+	for _, c := range clients {
+		objects := make(map[string]int64)
+		if c.Index != nil {
+			for _, a := range c.Index.Data {
+				objects["object:"+a.Hash] = a.Size
+			}
+			size, ok := indexSizes[c.IndexKey]
+			if !ok {
+				fi, err := s.st.Stat(c.IndexPath)
+				if err != nil {
+					return nil, fmt.Errorf("assets index \"%s\": %v", c.IndexKey, err)
+				}
+				size = fi.Size
+				indexSizes[c.IndexKey] = size
+			}
+			objects["index:"+c.IndexKey] = size
+		}
+		clientAssets[c] = objects
+	}
+
+	for _, c := range clients {
+		use(jars, c.Files.Main.Hash, c.Prefix)
+		for path := range c.Files.Libs {
+			use(libs, path, c.Prefix)
+		}
+		for key := range clientAssets[c] {
+			use(assets, key, c.Prefix)
+		}
+	}
+
+	var list []*PrefixUsage
+	byName := make(map[string]*PrefixUsage)
+	// objects already counted in prefix totals, object shared by prefixes is counted in each of them
+	counted := make(map[string]bool)
+
+	for _, c := range clients {
+		pu, ok := byName[c.Prefix]
+		if !ok {
+			pu = &PrefixUsage{Prefix: c.Prefix}
+			byName[c.Prefix] = pu
+			list = append(list, pu)
+		}
+
+		vu := &VersionUsage{Version: c.Version, Jar: c.Files.Main.Size}
+		if c.Files.Files != nil {
+			for _, info := range c.Files.Files.Index {
+				vu.Files += info.Size
+			}
+		}
+		for path, info := range c.Files.Libs {
+			vu.Libs.add(info.Size, libs[path].clients == 1)
+			if !counted[c.Prefix+"\x00lib:"+path] {
+				counted[c.Prefix+"\x00lib:"+path] = true
+				pu.Libs.add(info.Size, len(libs[path].prefixes) == 1)
+			}
+		}
+		for key, size := range clientAssets[c] {
+			vu.Assets.add(size, assets[key].clients == 1)
+			if !counted[c.Prefix+"\x00asset:"+key] {
+				counted[c.Prefix+"\x00asset:"+key] = true
+				pu.Assets.add(size, len(assets[key].prefixes) == 1)
+			}
+		}
+		vu.Freed = vu.Files + vu.Libs.Unique + vu.Assets.Unique
+		jar := jars[c.Files.Main.Hash]
+		if jar.clients == 1 {
+			vu.Freed += vu.Jar
+		}
+
+		pu.Versions = append(pu.Versions, vu)
+		pu.Freed += vu.Files
+		if key := c.Prefix + "\x00jar:" + c.Files.Main.Hash; !counted[key] && len(jar.prefixes) == 1 {
+			counted[key] = true
+			pu.Freed += vu.Jar
+		}
+	}
+
+	for _, pu := range list {
+		pu.Freed += pu.Libs.Unique + pu.Assets.Unique
+	}
+	return list, nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import "testing"
+
+func TestDiskUsageShared(t *testing.T) {
+	st := NewMemStorage()
+	s, err := New(Options{Storage: st})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// linked jar is shared by both clients, assets index only by the first one
+	index := `{"objects":{"a":{"hash":"` + sha1Hex("a") + `","size":1}}}`
+	data := `{"main":{"hash":"` + sha1Hex("jar") + `","size":3}}`
+	for path, data := range map[string]string{
+		"default/base/base.json":         `{"id":"base","type":"release","assets":"idx"}`,
+		"default/base/data.json":         data,
+		"default/link/link.json":         `{"id":"link","type":"release"}`,
+		"default/link/data.json":         data,
+		"default/versions/versions.json": `{"latest":{},"versions":[{"id":"base","type":"release"},{"id":"link","type":"release"}]}`,
+		"assets/indexes/idx.json":        index,
+	} {
+		if err = writeFile(st, path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := s.DiskUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || len(list[0].Versions) != 2 {
+		t.Fatalf("unexpected usage: %+v", list)
+	}
+	base, link := list[0].Versions[0], list[0].Versions[1]
+	if want := int64(1 + len(index)); base.Assets.Unique != want || base.Freed != want {
+		t.Errorf("base: assets %+v, freed %d, want %d", base.Assets, base.Freed, want)
+	}
+	if link.Jar != 3 || link.Freed != 0 {
+		t.Errorf("link: jar %d, freed %d, want 3 and 0", link.Jar, link.Freed)
+	}
+	if want := int64(3 + 1 + len(index)); list[0].Freed != want {
+		t.Errorf("prefix freed %d, want %d", list[0].Freed, want)
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"bytes"
+	"sync"
+)
+
+// worker checks clients with own logger.
+// Buffered worker keeps log until flush,
+// so output of concurrently checked clients doesn't interleave.
+type worker struct {
+	*Store
+	log *Logger
+	buf *bytes.Buffer
+	// don't write or download anything, see Audit
+	readOnly bool
+	// files recorded as missing in offline or read-only mode
+	missed []string
+	// client being checked, for events
+	client string
+}
+
+func (s *Store) newWorker() *worker {
+	return &worker{Store: s, log: s.log}
+}
+
+func (s *Store) newBufferedWorker() *worker {
+	buf := new(bytes.Buffer)
+	return &worker{
+		Store: s,
+		log:   s.log.withOutput(buf),
+		buf:   buf,
+	}
+}
+
+// flush writes buffered log to the store logger output.
+func (w *worker) flush() {
+	if w.buf == nil {
+		return
+	}
+	_, _ = w.Store.log.Writer().Write(w.buf.Bytes())
+	w.buf.Reset()
+}
+
+// checkedSet is shared between workers and holds objects,
+// that are already checked by any client.
+type checkedSet struct {
+	mu              sync.Mutex
+	libs            map[string]FInfo
+	indexes, assets map[string]bool
+	locks           map[string]*keyLock
+}
+
+// keyLock is dropped from checkedSet once nobody holds or waits for it.
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newCheckedSet() *checkedSet {
+	return &checkedSet{
+		libs:    make(map[string]FInfo),
+		indexes: make(map[string]bool),
+		assets:  make(map[string]bool),
+		locks:   make(map[string]*keyLock),
+	}
+}
+
+func (c *checkedSet) Lib(path string) (FInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, ok := c.libs[path]
+	return info, ok
+}
+
+func (c *checkedSet) SetLib(path string, info FInfo) {
+	c.mu.Lock()
+	c.libs[path] = info
+	c.mu.Unlock()
+}
+
+func (c *checkedSet) Index(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.indexes[key]
+}
+
+func (c *checkedSet) SetIndex(key string) {
+	c.mu.Lock()
+	c.indexes[key] = true
+	c.mu.Unlock()
+}
+
+func (c *checkedSet) Asset(hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.assets[hash]
+}
+
+func (c *checkedSet) SetAsset(hash string) {
+	c.mu.Lock()
+	c.assets[hash] = true
+	c.mu.Unlock()
+}
+
+// Lock serializes work on the same object across workers,
+// e.g. two clients must not download one library simultaneously.
+// Returns unlock function.
+func (c *checkedSet) Lock(key string) func() {
+	c.mu.Lock()
+	l, ok := c.locks[key]
+	if !ok {
+		l = new(keyLock)
+		c.locks[key] = l
+	}
+	l.refs++
+	c.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		c.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(c.locks, key)
+		}
+		c.mu.Unlock()
+	}
+}